@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLightActions(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "remote", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-remote"},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event: "pushbutton:remote:on",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "colorTemperature", Device: "lamp", ColorTemperature: 2700},
+					{Verb: "brightness", Device: "lamp", Brightness: 30},
+				},
+			},
+			{
+				Event: "pushbutton:remote:arrow_left",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "color", Device: "lamp", Color: "orange"},
+					{Verb: "color", Device: "lamp", Color: "#00ff00"},
+				},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	press := func(button string) string {
+		app.handleIncomingEvent(hapitypes.NewPushButtonEvent("remote", button))
+
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+
+		msgs := []string{}
+		for len(zigbee.Outbound) > 0 {
+			switch e := (<-zigbee.Outbound).(type) {
+			case *hapitypes.BrightnessMsg:
+				msgs = append(msgs, fmt.Sprintf("brightness %d", e.Brightness))
+			case *hapitypes.ColorMsg:
+				msgs = append(msgs, fmt.Sprintf("color %s", e.Color.Hex()))
+			case *hapitypes.ColorTemperatureEvent:
+				msgs = append(msgs, fmt.Sprintf("colortemp %d", e.TemperatureInKelvin))
+			}
+		}
+		return strings.Join(msgs, "; ")
+	}
+
+	assert.EqualString(t, press("on"), "colortemp 2700; brightness 30")
+	assert.EqualString(t, press("arrow_left"), "color #ff8000; color #00ff00")
+}
+
+func TestValidateLightAction(t *testing.T) {
+	validate := func(action hapitypes.ActionConfig) string {
+		if err := validateLightAction(action); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "brightness", Device: "lamp", Brightness: 100}), "")
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "brightness", Device: "lamp", Brightness: 101}), "brightness lamp: brightness over 100 %: 101")
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "color", Device: "lamp", Color: "orange"}), "")
+	assert.Assert(t, strings.HasPrefix(validate(hapitypes.ActionConfig{Verb: "color", Device: "lamp", Color: "not-a-color"}), "color lamp: "))
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "colorTemperature", Area: "kitchen"}), "colorTemperature kitchen: color temperature not specified")
+}
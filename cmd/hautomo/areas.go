@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+)
+
+// rooms & floors. areas are addressable like devices (Alexa, POST /command): a command to an
+// area is sent to its (and its sub-areas') devices that support the command
+type areaRegistry struct {
+	areas   []hapitypes.AreaConfig // in config order
+	devices map[string][]string    // device ids keyed by area id. includes sub-areas' devices
+}
+
+func newAreaRegistry(conf *hapitypes.ConfigFile) (*areaRegistry, error) {
+	if err := hapitypes.ValidateAreas(conf); err != nil {
+		return nil, err
+	}
+
+	devices := map[string][]string{}
+	for _, area := range conf.Areas {
+		devices[area.Id] = hapitypes.AreaDevices(area.Id, conf)
+	}
+
+	return &areaRegistry{
+		areas:   conf.Areas,
+		devices: devices,
+	}, nil
+}
+
+func (r *areaRegistry) Has(areaId string) bool {
+	_, found := r.devices[areaId]
+	return found
+}
+
+// falls back to id if area has no name
+func (r *areaRegistry) Name(areaId string) string {
+	for _, area := range r.areas {
+		if area.Id == areaId && area.Name != "" {
+			return area.Name
+		}
+	}
+
+	return areaId
+}
+
+// area's devices that support the capability ("" = all)
+func (a *Application) devicesInArea(areaId string, capability string) []*hapitypes.Device {
+	devices := []*hapitypes.Device{}
+
+	for _, deviceId := range a.areas.devices[areaId] {
+		device := a.deviceById[deviceId]
+
+		if capability == "" || hasCapability(device.DeviceType.Capabilities, capability) {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices
+}
+
+// area's devices get their own copies of the event, with the same correlation id
+func (a *Application) sendToArea(areaId string, capability string, inboundEvent hapitypes.InboundEvent) {
+	if retargetInboundEvent(inboundEvent, areaId) == nil { // f.ex. state reports are not commands
+		a.reportHubResult(inboundEvent, fmt.Errorf("cannot send %s to area %s", inboundEvent.InboundEventType(), areaId))
+		return
+	}
+
+	devices := a.devicesInArea(areaId, capability)
+	if len(devices) == 0 {
+		a.reportHubResult(inboundEvent, fmt.Errorf("area %s has no devices that support %s", areaId, capability))
+		return
+	}
+
+	// toggle the area as a whole, so devices in mixed states don't just swap places
+	if power, is := inboundEvent.(*hapitypes.PowerEvent); is && power.Kind == hapitypes.PowerKindToggle {
+		resolved := *power
+		resolved.Kind = hapitypes.PowerKindOn
+		if a.anyOn(devices) {
+			resolved.Kind = hapitypes.PowerKindOff
+		}
+
+		inboundEvent = &resolved
+	}
+
+	a.inbound.Results.FanOut(inboundEvent.Meta().CorrelationId, len(devices))
+
+	for _, device := range devices {
+		a.handleIncomingEvent(retargetInboundEvent(inboundEvent, device.Conf.DeviceId))
+	}
+}
+
+// runs the action for each of the area's devices that support the verb (or action's capability)
+func (a *Application) runAreaAction(action hapitypes.ActionConfig, trigger string) error {
+	capability := action.Capability
+	if capability == "" {
+		capability = verbCapability(action.Verb)
+	}
+
+	if capability == "" { // would be every device in the area
+		return fmt.Errorf("%s: needs capability to target an area", action.Verb)
+	}
+
+	devices := a.devicesInArea(action.Area, capability)
+
+	verb := action.Verb
+	if verb == "powerToggle" { // see sendToArea()
+		verb = "powerOn"
+		if a.anyOn(devices) {
+			verb = "powerOff"
+		}
+	}
+
+	for _, device := range devices {
+		deviceAction := action
+		deviceAction.Area = ""
+		deviceAction.Device = device.Conf.DeviceId
+		deviceAction.Verb = verb
+
+		if err := a.runAction(deviceAction, trigger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// catches config mistakes on startup instead of when the action first runs
+func (a *Application) validateAreaAction(action hapitypes.ActionConfig) error {
+	if action.Device != "" {
+		return fmt.Errorf("%s: both device and area specified", action.Verb)
+	}
+
+	if !a.areas.Has(action.Area) {
+		return fmt.Errorf("%s: area %s not found", action.Verb, action.Area)
+	}
+
+	switch action.Verb {
+	case "powerOn", "powerOff", "powerToggle", "blink", "ir", "playback", "notify", "brightness", "color", "colorTemperature":
+	default:
+		return fmt.Errorf("%s: verb cannot target an area", action.Verb)
+	}
+
+	if action.Capability != "" && !hasCapability(hapitypes.Capabilities{
+		Power:            true,
+		Brightness:       true,
+		Color:            true,
+		ColorTemperature: true,
+		Playback:         true,
+	}, action.Capability) {
+		return fmt.Errorf("%s: unknown capability: %s", action.Verb, action.Capability)
+	}
+
+	// blink, ir and notify make sense only for some devices, but don't imply which
+	if action.Capability == "" && verbCapability(action.Verb) == "" {
+		return fmt.Errorf("%s: needs capability to target an area", action.Verb)
+	}
+
+	return nil
+}
+
+func (a *Application) anyOn(devices []*hapitypes.Device) bool {
+	for _, device := range devices {
+		if a.powerManager.GetActual(device.Conf.DeviceId) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// capability a device needs to support the verb. "" if none
+func verbCapability(verb string) string {
+	switch verb {
+	case "powerOn", "powerOff", "powerToggle":
+		return "power"
+	case "brightness":
+		return "brightness"
+	case "color":
+		return "color"
+	case "colorTemperature":
+		return "colortemperature"
+	case "playback":
+		return "playback"
+	default:
+		return ""
+	}
+}
+
+// copy of the event targeted at another device. nil if the event is not a command that can be
+// sent to an area
+func retargetInboundEvent(inboundEvent hapitypes.InboundEvent, deviceId string) hapitypes.InboundEvent {
+	switch e := inboundEvent.(type) {
+	case *hapitypes.PowerEvent:
+		retargeted := *e
+		retargeted.DeviceIdOrDeviceGroupId = deviceId
+		return &retargeted
+	case *hapitypes.BrightnessEvent:
+		retargeted := *e
+		retargeted.DeviceIdOrDeviceGroupId = deviceId
+		return &retargeted
+	case *hapitypes.ColorMsg:
+		retargeted := *e
+		retargeted.DeviceId = deviceId
+		return &retargeted
+	case *hapitypes.ColorTemperatureEvent:
+		retargeted := *e
+		retargeted.Device = deviceId
+		return &retargeted
+	case *hapitypes.PlaybackEvent:
+		retargeted := *e
+		retargeted.Device = deviceId
+		return &retargeted
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAreas(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Areas: []hapitypes.AreaConfig{
+			{Id: "groundFloor", Name: "Ground floor"},
+			{Id: "kitchen", Name: "Kitchen", Parent: "groundFloor"},
+			{Id: "hallway", Name: "Hallway", Parent: "groundFloor"},
+			{Id: "attic", Name: "Attic"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "ceiling", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb", Area: "kitchen"},
+			{DeviceId: "coffeeMaker", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-smartplug", Area: "kitchen"},
+			{DeviceId: "hallwayLight", AdapterId: "zigbee", AdaptersDeviceId: "0x03", Type: "ikea-trådfri-noncolored", Area: "hallway"},
+			{DeviceId: "atticPlug", AdapterId: "zigbee", AdaptersDeviceId: "0x04", Type: "ikea-trådfri-smartplug", Area: "attic"},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event: "custom:leaving",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "powerOff", Area: "groundFloor"},
+				},
+			},
+			{
+				Event: "custom:dim",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "brightness", Area: "groundFloor", Brightness: 30},
+				},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	sent := func() string {
+		// actions are dispatched via the inbound fabric
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+
+		app.applyPowerDiffs()
+
+		msgs := []string{}
+
+		adapter := app.adapterById["zigbee"]
+		for len(adapter.Outbound) > 0 {
+			e := <-adapter.Outbound
+
+			switch msg := e.(type) {
+			case *hapitypes.PowerMsg:
+				if msg.On {
+					msgs = append(msgs, e.OutMeta().Device+" on")
+				} else {
+					msgs = append(msgs, e.OutMeta().Device+" off")
+				}
+			default:
+				msgs = append(msgs, e.OutMeta().Device+" "+e.OutboundEventType())
+			}
+		}
+
+		return strings.Join(msgs, ", ")
+	}
+
+	// sub-areas' devices are included
+	app.handleIncomingEvent(hapitypes.NewPowerEvent("groundFloor", hapitypes.PowerKindOn, true))
+	assert.EqualString(t, sent(), "ceiling on, coffeeMaker on, hallwayLight on")
+
+	// toggled as a whole: coffee maker is on, so kitchen turns off (explicit commands are
+	// re-sent even to devices already in that state)
+	app.handleIncomingEvent(hapitypes.NewPowerEvent("ceiling", hapitypes.PowerKindOff, true))
+	assert.EqualString(t, sent(), "ceiling off")
+	toggle := hapitypes.NewPowerToggleEvent("kitchen", true)
+	app.handleIncomingEvent(&toggle)
+	assert.EqualString(t, sent(), "ceiling off, coffeeMaker off")
+
+	// only devices that support the command
+	app.handleIncomingEvent(hapitypes.NewBrightnessEvent("kitchen", 50))
+	assert.EqualString(t, sent(), "ceiling BrightnessMsg")
+
+	// commands that don't need a capability can't be sent to areas
+	app.handleIncomingEvent(hapitypes.NewBlinkEvent("kitchen"))
+	assert.EqualString(t, sent(), "")
+	assert.EqualString(t, app.rejections.recent[0].Message, "area kitchen does not support BlinkEvent")
+
+	app.publish("custom:leaving")
+	assert.EqualString(t, sent(), "hallwayLight off")
+
+	app.publish("custom:dim")
+	assert.EqualString(t, sent(), "ceiling BrightnessMsg, hallwayLight BrightnessMsg")
+}
+
+func TestAreaConfigErrors(t *testing.T) {
+	configure := func(conf *hapitypes.ConfigFile) string {
+		app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+		err := configureApp(app, conf, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil })
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	withAction := func(action hapitypes.ActionConfig) *hapitypes.ConfigFile {
+		return &hapitypes.ConfigFile{
+			Areas: []hapitypes.AreaConfig{
+				{Id: "kitchen"},
+			},
+			Subscriptions: []hapitypes.SubscribeConfig{
+				{Event: "custom:test", Actions: []hapitypes.ActionConfig{action}},
+			},
+		}
+	}
+
+	assert.EqualString(t, configure(&hapitypes.ConfigFile{
+		Areas: []hapitypes.AreaConfig{
+			{Id: "a", Parent: "b"},
+			{Id: "b", Parent: "a"},
+		},
+	}), "area a: parent cycle via a")
+
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "powerOn", Area: "kitchen"})), "")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "powerOn", Area: "bathroom"})), "subscription custom:test: powerOn: area bathroom not found")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "scene", Area: "kitchen"})), "subscription custom:test: scene: verb cannot target an area")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "powerOn", Area: "kitchen", Capability: "smell"})), "subscription custom:test: powerOn: unknown capability: smell")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "powerOn", Area: "kitchen", Device: "ceiling"})), "subscription custom:test: powerOn: both device and area specified")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "blink", Area: "kitchen"})), "subscription custom:test: blink: needs capability to target an area")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "notify", Area: "kitchen"})), "subscription custom:test: notify: needs capability to target an area")
+	assert.EqualString(t, configure(withAction(hapitypes.ActionConfig{Verb: "blink", Area: "kitchen", Capability: "color"})), "")
+}
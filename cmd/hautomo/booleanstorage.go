@@ -2,15 +2,31 @@ package main
 
 import (
 	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"sync"
 	"time"
 )
 
 type booleanStorage struct {
 	values           map[string]bool
 	changeTimestamps map[string]time.Time
+	declared         map[string]bool // declared in config (as opposed to built-in), thus persisted
+	clock            clock
+	metricDesc       *prometheus.Desc
+	mu               sync.Mutex
 }
 
-func NewBooleanStorage(keys ...string) *booleanStorage {
+// for UI
+type booleanStatus struct {
+	Name       string
+	Value      bool
+	LastChange time.Time
+	Persisted  bool
+}
+
+func NewBooleanStorage(clock clock, keys ...string) *booleanStorage {
 	values := map[string]bool{}
 	changeTimestamps := map[string]time.Time{}
 
@@ -19,10 +35,49 @@ func NewBooleanStorage(keys ...string) *booleanStorage {
 		changeTimestamps[key] = time.Time{} // zero
 	}
 
-	return &booleanStorage{values, changeTimestamps}
+	return &booleanStorage{
+		values:           values,
+		changeTimestamps: changeTimestamps,
+		declared:         map[string]bool{},
+		clock:            clock,
+		metricDesc: prometheus.NewDesc(
+			"hautomo_boolean",
+			"Boolean's value (1 = true)",
+			[]string{"boolean"},
+			nil),
+	}
+}
+
+// declares a boolean from config. value is restored from snapshot if there is one
+func (b *booleanStorage) Declare(conf hapitypes.BooleanConfig, snapshot *hapitypes.BooleanSnapshot) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if conf.Id == "" {
+		return fmt.Errorf("boolean without id")
+	}
+
+	if _, exists := b.values[conf.Id]; exists {
+		return fmt.Errorf("duplicate boolean %s", conf.Id)
+	}
+
+	b.declared[conf.Id] = true
+
+	if snapshot != nil {
+		b.values[conf.Id] = snapshot.Value
+		b.changeTimestamps[conf.Id] = snapshot.LastChange
+	} else {
+		b.values[conf.Id] = conf.Initial
+		b.changeTimestamps[conf.Id] = time.Time{} // zero
+	}
+
+	return nil
 }
 
 func (b *booleanStorage) GetLastChangeTime(key string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	changeTimestamp, exists := b.changeTimestamps[key]
 	if !exists {
 		return changeTimestamp, fmt.Errorf("boolean %s does not exist", key)
@@ -32,6 +87,9 @@ func (b *booleanStorage) GetLastChangeTime(key string) (time.Time, error) {
 }
 
 func (b *booleanStorage) Get(key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	value, exists := b.values[key]
 	if !exists {
 		return false, fmt.Errorf("boolean %s does not exist", key)
@@ -40,7 +98,22 @@ func (b *booleanStorage) Get(key string) (bool, error) {
 	return value, nil
 }
 
+func (b *booleanStorage) All() map[string]bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	values := map[string]bool{}
+	for key, value := range b.values {
+		values[key] = value
+	}
+
+	return values
+}
+
 func (b *booleanStorage) Set(key string, to bool) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	previousValue, exists := b.values[key]
 	if !exists {
 		return false, fmt.Errorf("boolean %s does not exist", key)
@@ -51,7 +124,65 @@ func (b *booleanStorage) Set(key string, to bool) (bool, error) {
 	}
 
 	b.values[key] = to
-	b.changeTimestamps[key] = time.Now()
+	b.changeTimestamps[key] = b.clock.Now()
 
 	return true, nil // value changed
 }
+
+// topic published when a boolean changes, f.ex. "boolean:anybodyHome:changes-to-true"
+func booleanChangeTopic(key string, to bool) string {
+	return fmt.Sprintf("boolean:%s:changes-to-%v", key, to)
+}
+
+// only declared booleans are persisted. built-in ones are computed
+func (b *booleanStorage) Snapshot() map[string]hapitypes.BooleanSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := map[string]hapitypes.BooleanSnapshot{}
+	for key := range b.declared {
+		snapshot[key] = hapitypes.BooleanSnapshot{
+			Value:      b.values[key],
+			LastChange: b.changeTimestamps[key],
+		}
+	}
+
+	return snapshot
+}
+
+func (b *booleanStorage) Statuses() []booleanStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := []booleanStatus{}
+	for key, value := range b.values {
+		statuses = append(statuses, booleanStatus{
+			Name:       key,
+			Value:      value,
+			LastChange: b.changeTimestamps[key],
+			Persisted:  b.declared[key],
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// contract of prometheus.Collector
+func (b *booleanStorage) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+func (b *booleanStorage) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range b.Statuses() {
+		value := 0.0
+		if status.Value {
+			value = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(b.metricDesc, prometheus.GaugeValue, value, status.Name)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestDeclaredBooleansPersist(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+
+	conf := &hapitypes.ConfigFile{
+		Booleans: []hapitypes.BooleanConfig{
+			{Id: "guestMode"},
+			{Id: "alarmArmed", Initial: true},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event: "custom:guests-arrived",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "setBooleanTrue", Boolean: "guestMode"},
+					{Verb: "setBooleanFalse", Boolean: "alarmArmed"},
+				},
+			},
+		},
+	}
+
+	start := func(statefile hapitypes.Statefile) *Application {
+		app := newApplication(logex.Discard, nil, newSimulatedClock(t0))
+		app.spawn = func(fn func()) { fn() }
+
+		assert.Assert(t, configureApp(app, conf, statefile, logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+		return app
+	}
+
+	app := start(hapitypes.NewStatefile())
+
+	values := func() (bool, bool) {
+		guestMode, err := app.booleans.Get("guestMode")
+		assert.Assert(t, err == nil)
+		alarmArmed, err := app.booleans.Get("alarmArmed")
+		assert.Assert(t, err == nil)
+		return guestMode, alarmArmed
+	}
+
+	guestMode, alarmArmed := values()
+	assert.Assert(t, !guestMode && alarmArmed)
+
+	app.publish("custom:guests-arrived")
+
+	guestMode, alarmArmed = values()
+	assert.Assert(t, guestMode && !alarmArmed)
+
+	// built-ins are computed, so they're not persisted
+	snapshot := app.booleans.Snapshot()
+	assert.Assert(t, len(snapshot) == 2)
+	assert.Assert(t, snapshot["guestMode"].Value)
+	assert.Assert(t, snapshot["guestMode"].LastChange.Equal(t0))
+
+	statefile := hapitypes.NewStatefile()
+	statefile.Booleans = snapshot
+
+	app = start(statefile)
+
+	guestMode, alarmArmed = values()
+	assert.Assert(t, guestMode && !alarmArmed)
+
+	lastChange, err := app.booleans.GetLastChangeTime("guestMode")
+	assert.Assert(t, err == nil)
+	assert.Assert(t, lastChange.Equal(t0))
+}
+
+func TestDeclareBooleanErrors(t *testing.T) {
+	booleans := NewBooleanStorage(newSimulatedClock(time.Now()), "anybodyHome")
+
+	assert.EqualString(t, booleans.Declare(hapitypes.BooleanConfig{Id: "anybodyHome"}, nil).Error(), "duplicate boolean anybodyHome")
+	assert.EqualString(t, booleans.Declare(hapitypes.BooleanConfig{}, nil).Error(), "boolean without id")
+
+	_, err := booleans.Set("guestMode", true)
+	assert.EqualString(t, err.Error(), "boolean guestMode does not exist")
+}
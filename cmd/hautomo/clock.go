@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// time source for the hub, so we can replay recorded events with a simulated clock
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, fn func())
+}
+
+type realClock struct{}
+
+func (r realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (r realClock) AfterFunc(d time.Duration, fn func()) {
+	time.AfterFunc(d, fn)
+}
+
+type simulatedTimer struct {
+	at time.Time
+	fn func()
+}
+
+// only moves forward when told to. timers fire synchronously from AdvanceTo()
+type simulatedClock struct {
+	now    time.Time
+	timers []simulatedTimer
+	mu     sync.Mutex
+}
+
+func newSimulatedClock(now time.Time) *simulatedClock {
+	return &simulatedClock{
+		now:    now,
+		timers: []simulatedTimer{},
+	}
+}
+
+func (s *simulatedClock) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now
+}
+
+func (s *simulatedClock) AfterFunc(d time.Duration, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timers = append(s.timers, simulatedTimer{s.now.Add(d), fn})
+
+	// stable so that timers with same deadline fire in order of registration
+	sort.SliceStable(s.timers, func(i, j int) bool {
+		return s.timers[i].at.Before(s.timers[j].at)
+	})
+}
+
+func (s *simulatedClock) NextTimer() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.timers) == 0 {
+		return time.Time{}, false
+	}
+
+	return s.timers[0].at, true
+}
+
+// fires (in chronological order) timers that are due before or at "to"
+func (s *simulatedClock) AdvanceTo(to time.Time) {
+	for {
+		s.mu.Lock()
+		if len(s.timers) == 0 || s.timers[0].at.After(to) {
+			if to.After(s.now) {
+				s.now = to
+			}
+			s.mu.Unlock()
+			return
+		}
+
+		due := s.timers[0]
+		s.timers = s.timers[1:]
+		s.now = due.at
+		s.mu.Unlock()
+
+		due.fn() // outside of lock, as fn may register new timers
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestCommandResultIsRoutedToOriginator(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "plug", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug"},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	command := func(e hapitypes.InboundEvent) <-chan hapitypes.CommandResult {
+		correlationId := hapitypes.NewCorrelationId()
+		e.Meta().CorrelationId = correlationId
+
+		results, _ := app.inbound.Results.Subscribe(correlationId)
+
+		app.handleIncomingEvent(e)
+		app.applyPowerDiffs()
+
+		return results
+	}
+
+	results := command(hapitypes.NewPowerEvent("plug", hapitypes.PowerKindOn, true))
+	assert.Assert(t, len(results) == 0)
+
+	msg := (<-zigbee.Outbound).(*hapitypes.PowerMsg)
+	assert.EqualString(t, msg.DeviceId, "0x01")
+	assert.EqualString(t, msg.OutMeta().Device, "plug")
+
+	zigbee.Report(msg, errors.New("coordinator unreachable"))
+
+	result := <-results
+	assert.EqualString(t, result.Device, "plug")
+	assert.EqualString(t, result.Adapter, "zigbee")
+	assert.EqualString(t, result.Error, "coordinator unreachable")
+
+	// already on => nothing to send, but originator gets a result
+	result = <-command(hapitypes.NewPowerEvent("plug", hapitypes.PowerKindOn, false))
+	assert.Assert(t, result.Succeeded())
+	assert.Assert(t, len(zigbee.Outbound) == 0)
+
+	result = <-command(hapitypes.NewPowerEvent("stalePlug", hapitypes.PowerKindOn, true))
+	assert.EqualString(t, result.Error, "rejected: device stalePlug not found")
+}
+
+func TestCommandResultsOfDeviceGroup(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "plug1", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug"},
+			{DeviceId: "plug2", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-smartplug"},
+		},
+		DeviceGroups: []hapitypes.DeviceGroupConfig{
+			{DeviceId: "plugs", Devices: []string{"plug1", "plug2"}},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	e := hapitypes.NewPowerEvent("plugs", hapitypes.PowerKindOn, true)
+	e.CorrelationId = hapitypes.NewCorrelationId()
+
+	results, unsubscribe := app.inbound.Results.Subscribe(e.CorrelationId)
+	defer unsubscribe()
+
+	app.handleIncomingEvent(e)
+	app.applyPowerDiffs()
+
+	// mirrors devicegroupadapter
+	groupMsg := <-app.adapterById["plugsGroup"].Outbound
+	for _, member := range []string{"plug1", "plug2"} {
+		app.handleIncomingEvent(hapitypes.RedirectInboundCorrelated(groupMsg, member))
+	}
+	app.applyPowerDiffs()
+
+	zigbee := app.adapterById["zigbee"]
+	zigbee.Report(<-zigbee.Outbound, nil)
+	zigbee.Report(<-zigbee.Outbound, errors.New("coordinator unreachable"))
+
+	collected, complete := hapitypes.CollectCommandResults(results, time.Second)
+	assert.Assert(t, complete)
+	assert.Assert(t, len(collected) == 2)
+	assert.Assert(t, !allSucceeded(collected))
+}
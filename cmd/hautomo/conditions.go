@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"github.com/function61/hautomo/pkg/suntimes"
+	"time"
+)
+
+var weekdaysByName = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func (a *Application) conditionsPass(conditions []hapitypes.ConditionConfig) bool {
+	for _, condition := range conditions {
+		passes, err := a.conditionPasses(condition)
+		if err != nil {
+			a.logl.Error.Printf("error evaluating condition: %v", err)
+			return false
+		}
+
+		if !passes {
+			a.logl.Debug.Printf("condition %s not met - bailing out", condition.Type)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *Application) conditionPasses(condition hapitypes.ConditionConfig) (bool, error) {
+	now := a.clock.Now()
+
+	switch condition.Type {
+	case "boolean-not-changed-within":
+		lastChange, err := a.booleans.GetLastChangeTime(condition.Boolean)
+		if err != nil {
+			return false, err
+		}
+
+		if now.Sub(lastChange).Seconds() < float64(condition.DurationSeconds) {
+			a.logl.Debug.Printf(
+				"boolean %s changed within %d seconds",
+				condition.Boolean,
+				condition.DurationSeconds)
+			return false, nil
+		}
+
+		return true, nil
+	case "boolean-is-false", "boolean-is-true":
+		val, err := a.booleans.Get(condition.Boolean)
+		if err != nil {
+			return false, err
+		}
+
+		expectedValue := condition.Type == "boolean-is-true"
+
+		if val != expectedValue {
+			a.logl.Debug.Printf(
+				"bool %s expected %v but got %v",
+				condition.Boolean,
+				expectedValue,
+				val)
+			return false, nil
+		}
+
+		return true, nil
+	case "time-between":
+		after, afterHappens, err := resolveTimeOfDay(condition.After, now)
+		if err != nil {
+			return false, err
+		}
+
+		before, beforeHappens, err := resolveTimeOfDay(condition.Before, now)
+		if err != nil {
+			return false, err
+		}
+
+		if !afterHappens || !beforeHappens {
+			return false, nil
+		}
+
+		return isBetweenTimesOfDay(now, after, before), nil
+	case "weekday-is":
+		for _, weekdayName := range condition.Weekdays {
+			weekday, known := weekdaysByName[weekdayName]
+			if !known {
+				return false, fmt.Errorf("unknown weekday: %s", weekdayName)
+			}
+
+			if now.Weekday() == weekday {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "sun-is-up", "sun-is-down":
+		sunTimes := suntimes.TimesOfDay(now, suntimes.Tampere)
+		sunrise, hasSunrise := sunTimes["sunrise"]
+		sunset, hasSunset := sunTimes["sunset"]
+
+		sunIsUp := hasSunrise && hasSunset && !now.Before(sunrise) && now.Before(sunset)
+
+		return sunIsUp == (condition.Type == "sun-is-up"), nil
+	case "device-is-on", "device-is-off":
+		if _, found := a.deviceById[condition.Device]; !found {
+			return false, fmt.Errorf("device %s not found", condition.Device)
+		}
+
+		isOn := a.powerManager.GetActual(condition.Device)
+
+		return isOn == (condition.Type == "device-is-on"), nil
+	case "sensor-threshold":
+		device, found := a.deviceById[condition.Device]
+		if !found {
+			return false, fmt.Errorf("device %s not found", condition.Device)
+		}
+
+		reading := device.LastTemperatureHumidityPressureEvent
+		if reading == nil {
+			a.logl.Debug.Printf("no reading from %s yet", condition.Device)
+			return false, nil
+		}
+
+		var value float64
+		switch condition.Attribute {
+		case "temperature":
+			value = reading.Temperature
+		case "humidity":
+			value = reading.Humidity
+		case "pressure":
+			value = reading.Pressure
+		default:
+			return false, fmt.Errorf("unknown sensor attribute: %s", condition.Attribute)
+		}
+
+		if condition.Above != nil && value <= *condition.Above {
+			return false, nil
+		}
+
+		if condition.Below != nil && value >= *condition.Below {
+			return false, nil
+		}
+
+		return true, nil
+	case "person-is-present", "person-is-away":
+		present, known := a.persons.IsPresent(condition.Person)
+		if !known {
+			return false, fmt.Errorf("person %s not found", condition.Person)
+		}
+
+		return present == (condition.Type == "person-is-present"), nil
+	case "variable-is":
+		value, err := a.variables.Get(condition.Variable)
+		if err != nil {
+			return false, err
+		}
+
+		conf, err := a.variables.Conf(condition.Variable)
+		if err != nil {
+			return false, err
+		}
+
+		// compare canonical forms, so "1.0" equals "1"
+		expected, err := canonicalVariableValue(conf, condition.Value)
+		if err != nil {
+			return false, err
+		}
+
+		return value == expected, nil
+	case "variable-threshold":
+		value, err := a.variables.GetNumber(condition.Variable)
+		if err != nil {
+			return false, err
+		}
+
+		if condition.Above != nil && value <= *condition.Above {
+			return false, nil
+		}
+
+		if condition.Below != nil && value >= *condition.Below {
+			return false, nil
+		}
+
+		return true, nil
+	case "variable-not-changed-within":
+		lastChange, err := a.variables.GetLastChangeTime(condition.Variable)
+		if err != nil {
+			return false, err
+		}
+
+		return now.Sub(lastChange).Seconds() >= float64(condition.DurationSeconds), nil
+	case "all", "not":
+		allPass := true
+		for _, nested := range condition.Conditions {
+			passes, err := a.conditionPasses(nested)
+			if err != nil {
+				return false, err
+			}
+
+			if !passes {
+				allPass = false
+				break
+			}
+		}
+
+		if condition.Type == "not" {
+			return !allPass, nil
+		}
+
+		return allPass, nil
+	case "any":
+		for _, nested := range condition.Conditions {
+			passes, err := a.conditionPasses(nested)
+			if err != nil {
+				return false, err
+			}
+
+			if passes {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown condition type: %s", condition.Type)
+	}
+}
+
+// catches config mistakes on startup instead of when the condition is first evaluated
+func (a *Application) validateCondition(condition hapitypes.ConditionConfig) error {
+	requireDevice := func() error {
+		if _, found := a.deviceById[condition.Device]; !found {
+			return fmt.Errorf("condition %s: device %s not found", condition.Type, condition.Device)
+		}
+		return nil
+	}
+
+	switch condition.Type {
+	case "boolean-not-changed-within", "boolean-is-false", "boolean-is-true":
+		if _, err := a.booleans.Get(condition.Boolean); err != nil {
+			return fmt.Errorf("condition %s: %v", condition.Type, err)
+		}
+	case "time-between":
+		for _, spec := range []string{condition.After, condition.Before} {
+			if _, _, err := resolveTimeOfDay(spec, a.clock.Now()); err != nil {
+				return fmt.Errorf("condition %s: %v", condition.Type, err)
+			}
+		}
+	case "weekday-is":
+		if len(condition.Weekdays) == 0 {
+			return fmt.Errorf("condition %s: no weekdays", condition.Type)
+		}
+
+		for _, weekdayName := range condition.Weekdays {
+			if _, known := weekdaysByName[weekdayName]; !known {
+				return fmt.Errorf("condition %s: unknown weekday: %s", condition.Type, weekdayName)
+			}
+		}
+	case "sun-is-up", "sun-is-down":
+	case "device-is-on", "device-is-off":
+		return requireDevice()
+	case "sensor-threshold":
+		if err := requireDevice(); err != nil {
+			return err
+		}
+
+		switch condition.Attribute {
+		case "temperature", "humidity", "pressure":
+		default:
+			return fmt.Errorf("condition %s: unknown sensor attribute: %s", condition.Type, condition.Attribute)
+		}
+
+		if condition.Above == nil && condition.Below == nil {
+			return fmt.Errorf("condition %s: needs above and/or below", condition.Type)
+		}
+	case "person-is-present", "person-is-away":
+		if !a.persons.Has(condition.Person) {
+			return fmt.Errorf("condition %s: person %s not found", condition.Type, condition.Person)
+		}
+	case "variable-is", "variable-threshold", "variable-not-changed-within":
+		conf, err := a.variables.Conf(condition.Variable)
+		if err != nil {
+			return fmt.Errorf("condition %s: %v", condition.Type, err)
+		}
+
+		switch condition.Type {
+		case "variable-is":
+			if _, err := canonicalVariableValue(conf, condition.Value); err != nil {
+				return fmt.Errorf("condition %s: %s: %v", condition.Type, condition.Variable, err)
+			}
+		case "variable-threshold":
+			if conf.Type == variableTypeEnum {
+				return fmt.Errorf("condition %s: %s is not a number", condition.Type, condition.Variable)
+			}
+
+			if condition.Above == nil && condition.Below == nil {
+				return fmt.Errorf("condition %s: needs above and/or below", condition.Type)
+			}
+		}
+	case "all", "any", "not":
+		if len(condition.Conditions) == 0 {
+			return fmt.Errorf("condition %s: no nested conditions", condition.Type)
+		}
+
+		for _, nested := range condition.Conditions {
+			if err := a.validateCondition(nested); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown condition type: %s", condition.Type)
+	}
+
+	return nil
+}
+
+// spec is "22:00" or sun event like "sunset-30m". returns false if the sun event doesn't
+// happen on now's day
+func resolveTimeOfDay(spec string, now time.Time) (time.Time, bool, error) {
+	if spec == "" {
+		return time.Time{}, false, errors.New("time of day not specified")
+	}
+
+	if clockTime, err := time.Parse("15:04", spec); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), clockTime.Hour(), clockTime.Minute(), 0, 0, now.Location()), true, nil
+	}
+
+	sun, err := parseSunSchedule(spec)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("time of day %s is neither HH:MM nor sun event: %v", spec, err)
+	}
+
+	at, happens := sun.At(now)
+	return at, happens, nil
+}
+
+// "after" greater than "before" means the window spans midnight, like 22:00 - 06:00
+func isBetweenTimesOfDay(now time.Time, after time.Time, before time.Time) bool {
+	if after.After(before) {
+		return !now.Before(after) || now.Before(before)
+	}
+
+	return !now.Before(after) && now.Before(before)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestConditions(t *testing.T) {
+	// monday evening, sun has set
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 4, 22, 30, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "bathroomSensor", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "aqara-temperature-humidity"},
+		},
+		Persons: []hapitypes.Person{
+			{Id: "joonas"},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	app.handleIncomingEvent(hapitypes.NewPowerEvent("lamp", hapitypes.PowerKindOn, true))
+	app.applyPowerDiffs()
+	app.handleIncomingEvent(hapitypes.NewTemperatureHumidityPressureEvent("bathroomSensor", 22.5, 71.5, 1000))
+	app.handleIncomingEvent(hapitypes.NewPersonPresenceChangeEvent("joonas", true))
+
+	num := func(val float64) *float64 { return &val }
+
+	tests := []struct {
+		name      string
+		condition hapitypes.ConditionConfig
+		expected  bool
+	}{
+		{"in window", hapitypes.ConditionConfig{Type: "time-between", After: "22:00", Before: "23:00"}, true},
+		{"window over midnight", hapitypes.ConditionConfig{Type: "time-between", After: "22:00", Before: "06:00"}, true},
+		{"outside window", hapitypes.ConditionConfig{Type: "time-between", After: "06:00", Before: "22:00"}, false},
+		{"after sunset", hapitypes.ConditionConfig{Type: "time-between", After: "sunset+30m", Before: "sunrise"}, true},
+		{"weekday", hapitypes.ConditionConfig{Type: "weekday-is", Weekdays: []string{"mon", "tue"}}, true},
+		{"weekend", hapitypes.ConditionConfig{Type: "weekday-is", Weekdays: []string{"sat", "sun"}}, false},
+		{"sun up", hapitypes.ConditionConfig{Type: "sun-is-up"}, false},
+		{"sun down", hapitypes.ConditionConfig{Type: "sun-is-down"}, true},
+		{"lamp on", hapitypes.ConditionConfig{Type: "device-is-on", Device: "lamp"}, true},
+		{"lamp off", hapitypes.ConditionConfig{Type: "device-is-off", Device: "lamp"}, false},
+		{"humid", hapitypes.ConditionConfig{Type: "sensor-threshold", Device: "bathroomSensor", Attribute: "humidity", Above: num(70)}, true},
+		{"comfortable", hapitypes.ConditionConfig{Type: "sensor-threshold", Device: "bathroomSensor", Attribute: "temperature", Above: num(20), Below: num(22)}, false},
+		{"present", hapitypes.ConditionConfig{Type: "person-is-present", Person: "joonas"}, true},
+		{"away", hapitypes.ConditionConfig{Type: "person-is-away", Person: "joonas"}, false},
+		{"any", hapitypes.ConditionConfig{Type: "any", Conditions: []hapitypes.ConditionConfig{
+			{Type: "sun-is-up"},
+			{Type: "device-is-on", Device: "lamp"},
+		}}, true},
+		{"all", hapitypes.ConditionConfig{Type: "all", Conditions: []hapitypes.ConditionConfig{
+			{Type: "sun-is-up"},
+			{Type: "device-is-on", Device: "lamp"},
+		}}, false},
+		{"not", hapitypes.ConditionConfig{Type: "not", Conditions: []hapitypes.ConditionConfig{
+			{Type: "person-is-away", Person: "joonas"},
+		}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Assert(t, app.validateCondition(test.condition) == nil)
+			assert.Assert(t, app.conditionsPass([]hapitypes.ConditionConfig{test.condition}) == test.expected)
+		})
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 4, 22, 30, 0, 0, time.UTC)))
+
+	validate := func(condition hapitypes.ConditionConfig) string {
+		if err := app.validateCondition(condition); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "boolean-is-true", Boolean: "anybodyHome"}), "")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "boolean-is-true", Boolean: "nobodyHome"}), "condition boolean-is-true: boolean nobodyHome does not exist")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "time-between", After: "25:00", Before: "06:00"}), "condition time-between: time of day 25:00 is neither HH:MM nor sun event: sun 25:00: unknown event 25:00; supported: nadir, nightEnd, nauticalDawn, dawn, sunrise, sunriseEnd, goldenHourEnd, solarNoon, goldenHour, sunsetStart, sunset, dusk, nauticalDusk, night")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "weekday-is", Weekdays: []string{"monday"}}), "condition weekday-is: unknown weekday: monday")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "device-is-on", Device: "lamp"}), "condition device-is-on: device lamp not found")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "person-is-away", Person: "joonas"}), "condition person-is-away: person joonas not found")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "not"}), "condition not: no nested conditions")
+	assert.EqualString(t, validate(hapitypes.ConditionConfig{Type: "any", Conditions: []hapitypes.ConditionConfig{{Type: "bogus"}}}), "unknown condition type: bogus")
+}
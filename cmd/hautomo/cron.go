@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// classic 5-field cron expression: "minute hour day-of-month month day-of-week".
+// fields support "*", lists ("1,15"), ranges ("1-5") and steps ("*/15", "0-30/10").
+type cronExpr struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool // 0 = sunday
+	// if both day fields are restricted, either matching is enough (like in classic cron)
+	domRestricted bool
+	dowRestricted bool
+}
+
+func parseCronExpr(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %s: expecting 5 fields, got %d", expr, len(fields))
+	}
+
+	fieldRanges := []struct {
+		name string
+		min  int
+		max  int
+	}{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		{"day of week", 0, 7}, // 7 = sunday as well
+	}
+
+	parsed := []map[int]bool{}
+	for i, field := range fields {
+		values, err := parseCronField(field, fieldRanges[i].min, fieldRanges[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %s: %s: %v", expr, fieldRanges[i].name, err)
+		}
+
+		parsed = append(parsed, values)
+	}
+
+	if parsed[4][7] {
+		parsed[4][0] = true
+	}
+
+	return &cronExpr{
+		minutes:       parsed[0],
+		hours:         parsed[1],
+		daysOfMonth:   parsed[2],
+		months:        parsed[3],
+		daysOfWeek:    parsed[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			var err error
+			step, err = strconv.Atoi(part[slash+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step: %s", part)
+			}
+
+			part = part[:slash]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value: %s", part)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid value: %s", part)
+				}
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("out of range %d-%d: %s", min, max, part)
+		}
+
+		for value := from; value <= to; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+// first matching minute after "after", in after's location
+func (c *cronExpr) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// every combination repeats within a few years (leap days)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !c.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{} // never, f.ex. "0 0 31 2 *"
+}
+
+func (c *cronExpr) dayMatches(t time.Time) bool {
+	domMatches := c.daysOfMonth[t.Day()]
+	dowMatches := c.daysOfWeek[int(t.Weekday())]
+
+	if c.domRestricted && c.dowRestricted {
+		return domMatches || dowMatches
+	}
+
+	return domMatches && dowMatches
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"testing"
+	"time"
+)
+
+func TestCronExprNext(t *testing.T) {
+	// sunday
+	after := time.Date(2019, 11, 3, 7, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"* * * * *", "2019-11-03 07:31 Sun"},
+		{"*/15 * * * *", "2019-11-03 07:45 Sun"},
+		{"0 7 * * 1-5", "2019-11-04 07:00 Mon"},
+		{"30 7 * * *", "2019-11-04 07:30 Mon"},
+		{"0 8,20 * * *", "2019-11-03 08:00 Sun"},
+		{"0 0 1 * *", "2019-12-01 00:00 Sun"},
+		{"0 12 * * 7", "2019-11-03 12:00 Sun"},
+		{"0 0 29 2 *", "2020-02-29 00:00 Sat"},
+		// either day field matching is enough
+		{"0 0 15 * 1", "2019-11-04 00:00 Mon"},
+		{"0 0 31 2 *", "never"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			expr, err := parseCronExpr(test.expr)
+			assert.Assert(t, err == nil)
+
+			next := expr.Next(after)
+			if next.IsZero() {
+				assert.EqualString(t, "never", test.expected)
+			} else {
+				assert.EqualString(t, next.Format("2006-01-02 15:04 Mon"), test.expected)
+			}
+		})
+	}
+}
+
+func TestParseCronExprErrors(t *testing.T) {
+	errorFor := func(expr string) string {
+		_, err := parseCronExpr(expr)
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+
+	assert.EqualString(t, errorFor("0 7 * *"), "cron 0 7 * *: expecting 5 fields, got 4")
+	assert.EqualString(t, errorFor("60 7 * * *"), "cron 60 7 * * *: minute: out of range 0-59: 60")
+	assert.EqualString(t, errorFor("0 7 * * mon"), "cron 0 7 * * mon: day of week: invalid value: mon")
+	assert.EqualString(t, errorFor("*/0 7 * * *"), "cron */0 7 * * *: minute: invalid step: */0")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNestedDeviceGroups(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "ceiling", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "desk", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-noncolored"},
+			{DeviceId: "plug", AdapterId: "zigbee", AdaptersDeviceId: "0x03", Type: "ikea-trådfri-smartplug"},
+		},
+		DeviceGroups: []hapitypes.DeviceGroupConfig{
+			// defined before its member group, to check that order doesn't matter
+			{DeviceId: "everything", Devices: []string{"lights", "plug"}},
+			{DeviceId: "lights", Devices: []string{"ceiling", "desk"}},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	everything := app.deviceById["everything"]
+	assert.Assert(t, isDeviceGroup(everything))
+	assert.Assert(t, !isDeviceGroup(app.deviceById["plug"]))
+	assert.Assert(t, app.deviceById["lights"].DeviceType.Capabilities.Brightness)
+	assert.Assert(t, !everything.DeviceType.Capabilities.Brightness)
+
+	// mirrors devicegroupadapter, and collects what reaches the real devices
+	settle := func() string {
+		sent := []string{}
+
+		for progressed := true; progressed; {
+			progressed = false
+
+			for _, adapterId := range []string{"everythingGroup", "lightsGroup", "zigbee"} {
+				adapter := app.adapterById[adapterId]
+
+				for len(adapter.Outbound) > 0 {
+					progressed = true
+
+					e := <-adapter.Outbound
+
+					if adapter.Conf.Type == "devicegroup" {
+						for _, to := range adapter.Conf.DevicegroupDevices {
+							app.handleIncomingEvent(hapitypes.RedirectInboundCorrelated(e, to))
+						}
+						app.applyPowerDiffs()
+						continue
+					}
+
+					powerMsg := e.(*hapitypes.PowerMsg)
+					if powerMsg.On {
+						sent = append(sent, e.OutMeta().Device+" on")
+					} else {
+						sent = append(sent, e.OutMeta().Device+" off")
+					}
+				}
+			}
+		}
+
+		return strings.Join(sent, ", ")
+	}
+
+	handle := func(e hapitypes.InboundEvent) {
+		app.handleIncomingEvent(e)
+		app.applyPowerDiffs()
+	}
+
+	handle(hapitypes.NewPowerEvent("everything", hapitypes.PowerKindOn, true))
+	assert.EqualString(t, settle(), "plug on, ceiling on, desk on")
+
+	// group is on if any member is on
+	handle(hapitypes.NewPowerEvent("lights", hapitypes.PowerKindOff, true))
+	assert.EqualString(t, settle(), "ceiling off, desk off")
+	assert.Assert(t, !app.deviceById["lights"].ProbablyTurnedOn)
+	assert.Assert(t, everything.ProbablyTurnedOn)
+
+	toggle := hapitypes.NewPowerToggleEvent("everything", true)
+	handle(&toggle)
+	// explicit all the way down, so also the lights (that were already off) are told off
+	assert.EqualString(t, settle(), "plug off, ceiling off, desk off")
+	assert.Assert(t, !everything.ProbablyTurnedOn)
+
+	handle(hapitypes.NewPowerEvent("desk", hapitypes.PowerKindOn, true))
+	assert.EqualString(t, settle(), "desk on")
+	assert.Assert(t, everything.ProbablyTurnedOn)
+
+	// capabilities are intersection of members'
+	handle(hapitypes.NewBrightnessEvent("everything", 50))
+	assert.EqualString(t, app.rejections.recent[0].Message, "device everything (devicegroup) does not support brightness")
+}
+
+func TestExplicitGroupCommandBypassesMemberLimits(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC))
+
+	app := newApplication(logex.Discard, nil, clock)
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "amp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug", MinOnSeconds: 600},
+		},
+		DeviceGroups: []hapitypes.DeviceGroupConfig{
+			{DeviceId: "stereo", Devices: []string{"amp"}},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	group := app.adapterById["stereoGroup"]
+	zigbee := app.adapterById["zigbee"]
+
+	// mirrors devicegroupadapter. returns what reached the amp
+	handle := func(e hapitypes.InboundEvent) string {
+		app.handleIncomingEvent(e)
+		app.applyPowerDiffs()
+
+		for len(group.Outbound) > 0 {
+			app.handleIncomingEvent(hapitypes.RedirectInboundCorrelated(<-group.Outbound, "amp"))
+			app.applyPowerDiffs()
+		}
+
+		sent := []string{}
+		for len(zigbee.Outbound) > 0 {
+			if (<-zigbee.Outbound).(*hapitypes.PowerMsg).On {
+				sent = append(sent, "on")
+			} else {
+				sent = append(sent, "off")
+			}
+		}
+		return strings.Join(sent, ", ")
+	}
+
+	assert.EqualString(t, handle(hapitypes.NewPowerEvent("stereo", hapitypes.PowerKindOn, true)), "on")
+
+	// within amp's min on time
+	clock.AdvanceTo(clock.Now().Add(time.Minute))
+
+	// f.ex. a policy
+	assert.EqualString(t, handle(hapitypes.NewPowerEvent("stereo", hapitypes.PowerKindOff, false)), "")
+	assert.Assert(t, app.deviceById["amp"].ProbablyTurnedOn)
+
+	// user
+	assert.EqualString(t, handle(hapitypes.NewPowerEvent("stereo", hapitypes.PowerKindOff, true)), "off")
+}
+
+func TestDeviceGroupCycle(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	err := configureApp(app, &hapitypes.ConfigFile{
+		DeviceGroups: []hapitypes.DeviceGroupConfig{
+			{DeviceId: "a", Devices: []string{"b"}},
+			{DeviceId: "b", Devices: []string{"a"}},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil })
+
+	assert.EqualString(t, err.Error(), "device group a: device group cycle: a -> b -> a")
+}
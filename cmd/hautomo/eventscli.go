@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/eventjournal"
+	"github.com/spf13/cobra"
+	"regexp"
+	"time"
+)
+
+func eventsEntry() *cobra.Command {
+	events := &cobra.Command{
+		Use:   "events",
+		Short: "Query the event journal",
+	}
+
+	tailCount := 20
+
+	tail := &cobra.Command{
+		Use:   "tail",
+		Short: "Print latest events",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			latest := []eventjournal.Entry{}
+
+			if err := eventjournal.Read(eventJournalPath, journalReadLogger(), func(entry eventjournal.Entry) error {
+				latest = append(latest, entry)
+				if len(latest) > tailCount {
+					latest = latest[1:]
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, entry := range latest {
+				fmt.Println(entry.String())
+			}
+
+			return nil
+		},
+	}
+	tail.Flags().IntVarP(&tailCount, "lines", "n", tailCount, "Number of events to print")
+
+	events.AddCommand(tail)
+
+	events.AddCommand(&cobra.Command{
+		Use:   "grep [regexp]",
+		Short: "Print events matching a regular expression",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			re, err := regexp.Compile(args[0])
+			if err != nil {
+				return err
+			}
+
+			return printMatchingEvents(func(entry eventjournal.Entry, line string) bool {
+				return re.MatchString(line)
+			})
+		},
+	})
+
+	events.AddCommand(&cobra.Command{
+		Use:   "since [duration | RFC3339 timestamp]",
+		Short: "Print events since a point in time, f.ex. \"90m\" or \"2019-11-03T03:00:00+02:00\"",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			since, err := parseSince(args[0], time.Now())
+			if err != nil {
+				return err
+			}
+
+			return printMatchingEvents(func(entry eventjournal.Entry, line string) bool {
+				return !entry.Timestamp.Before(since)
+			})
+		},
+	})
+
+	// main() prints the error, and a read error is no reason to show usage
+	for _, subcommand := range events.Commands() {
+		subcommand.SilenceErrors = true
+		subcommand.SilenceUsage = true
+	}
+
+	return events
+}
+
+func printMatchingEvents(matches func(entry eventjournal.Entry, line string) bool) error {
+	return eventjournal.Read(eventJournalPath, journalReadLogger(), func(entry eventjournal.Entry) error {
+		line := entry.String()
+
+		if matches(entry, line) {
+			fmt.Println(line)
+		}
+
+		return nil
+	})
+}
+
+// for skipped malformed entries. stderr, so they don't mix with the output
+func journalReadLogger() *logex.Leveled {
+	return logex.Levels(logex.StandardLogger())
+}
+
+func parseSince(input string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(input); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a duration nor RFC3339 timestamp: %s", input)
+	}
+
+	return ts, nil
+}
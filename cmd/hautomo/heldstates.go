@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"time"
+)
+
+const (
+	heldStateContactOpen   = "contact-open"
+	heldStateContactClosed = "contact-closed"
+	heldStateNoMotion      = "no-motion"
+	heldStateWaterLeak     = "waterleak"
+	heldStateOffline       = "offline" // device not heard from
+)
+
+// f.ex. "door left open for 10 minutes"
+type heldStateTrigger struct {
+	conf     hapitypes.HeldStateConfig
+	device   *hapitypes.Device
+	duration time.Duration
+	firedFor time.Time // start of the episode we already fired for
+}
+
+func newHeldStateTrigger(conf hapitypes.HeldStateConfig, deviceById map[string]*hapitypes.Device) (*heldStateTrigger, error) {
+	if conf.Id == "" {
+		return nil, fmt.Errorf("held state without id")
+	}
+
+	device, found := deviceById[conf.Device]
+	if !found {
+		return nil, fmt.Errorf("held %s: device %s not found", conf.Id, conf.Device)
+	}
+
+	switch conf.State {
+	case heldStateContactOpen, heldStateContactClosed, heldStateNoMotion, heldStateWaterLeak, heldStateOffline:
+	default:
+		return nil, fmt.Errorf("held %s: unknown state: %s", conf.Id, conf.State)
+	}
+
+	if conf.DurationSeconds <= 0 {
+		return nil, fmt.Errorf("held %s: duration_seconds must be positive", conf.Id)
+	}
+
+	return &heldStateTrigger{
+		conf:     conf,
+		device:   device,
+		duration: time.Duration(conf.DurationSeconds) * time.Second,
+	}, nil
+}
+
+// returns nil if device is not in the state (or we don't know)
+func (h *heldStateTrigger) heldSince() *time.Time {
+	device := h.device
+
+	switch h.conf.State {
+	case heldStateContactOpen, heldStateContactClosed:
+		if device.LastContact == nil {
+			return nil
+		}
+
+		if device.LastContact.Contact != (h.conf.State == heldStateContactClosed) {
+			return nil
+		}
+
+		return device.ContactSince
+	case heldStateNoMotion:
+		return device.LastMotion
+	case heldStateWaterLeak:
+		return device.WaterLeakSince
+	case heldStateOffline:
+		return device.LastOnline
+	default:
+		return nil
+	}
+}
+
+// called from main loop's ticker
+func (a *Application) evaluateHeldStates() {
+	now := a.clock.Now()
+
+	for _, held := range a.heldStates {
+		since := held.heldSince()
+		if since == nil || now.Sub(*since) < held.duration {
+			continue
+		}
+
+		if held.firedFor.Equal(*since) {
+			continue
+		}
+
+		held.firedFor = *since
+
+		a.logl.Info.Printf(
+			"%s %s since %s",
+			held.conf.Device,
+			held.conf.State,
+			since.Format(time.RFC3339))
+
+		a.publish("held:" + held.conf.Id)
+	}
+}
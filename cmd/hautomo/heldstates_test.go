@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeldStates(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+	clock := newSimulatedClock(t0)
+
+	app := newApplication(logex.Discard, nil, clock)
+	app.spawn = func(fn func()) { fn() }
+
+	// held triggers are observed as color commands to the lamp
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "frontDoor", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "aqara-doorwindow"},
+			{DeviceId: "kitchenLeak", AdapterId: "zigbee", AdaptersDeviceId: "0x03", Type: "aqara-water-leak"},
+		},
+		HeldStates: []hapitypes.HeldStateConfig{
+			{Id: "doorLeftOpen", Device: "frontDoor", State: "contact-open", DurationSeconds: 600},
+			{Id: "leak", Device: "kitchenLeak", State: "waterleak", DurationSeconds: 60},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event:   "held:doorLeftOpen",
+				Actions: []hapitypes.ActionConfig{{Verb: "color", Device: "lamp", Color: "red"}},
+			},
+			{
+				Event:   "held:leak",
+				Actions: []hapitypes.ActionConfig{{Verb: "color", Device: "lamp", Color: "blue"}},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	colorNames := map[string]string{"#ff0000": "doorLeftOpen", "#0000ff": "leak"}
+
+	tick := func(at time.Duration) string {
+		clock.AdvanceTo(t0.Add(at))
+
+		app.evaluateHeldStates()
+
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+
+		fired := []string{}
+		for len(zigbee.Outbound) > 0 {
+			if colorMsg, is := (<-zigbee.Outbound).(*hapitypes.ColorMsg); is {
+				fired = append(fired, colorNames[colorMsg.Color.Hex()])
+			}
+		}
+		return strings.Join(fired, ", ")
+	}
+
+	contact := func(closed bool) {
+		app.handleIncomingEvent(hapitypes.NewContactEvent("frontDoor", closed, clock.Now()))
+	}
+
+	assert.EqualString(t, tick(0), "")
+
+	contact(false)
+	app.handleIncomingEvent(hapitypes.NewWaterLeakEvent("kitchenLeak", true))
+
+	assert.EqualString(t, tick(59*time.Second), "")
+	assert.EqualString(t, tick(60*time.Second), "leak")
+
+	// sensor re-reporting the same state doesn't restart the episode
+	contact(false)
+	app.handleIncomingEvent(hapitypes.NewWaterLeakEvent("kitchenLeak", true))
+
+	assert.EqualString(t, tick(10*time.Minute), "doorLeftOpen")
+
+	// fires only once per episode
+	assert.EqualString(t, tick(20*time.Minute), "")
+
+	// closing and re-opening starts a new episode
+	contact(true)
+	assert.EqualString(t, tick(25*time.Minute), "")
+	contact(false)
+	assert.EqualString(t, tick(34*time.Minute), "")
+	assert.EqualString(t, tick(35*time.Minute), "doorLeftOpen")
+}
+
+func TestHeldStatesSurviveRestart(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+	clock := newSimulatedClock(t0)
+
+	conf := &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "frontDoor", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "aqara-doorwindow"},
+		},
+		HeldStates: []hapitypes.HeldStateConfig{
+			{Id: "doorLeftOpen", Device: "frontDoor", State: "contact-open", DurationSeconds: 600},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event:   "held:doorLeftOpen",
+				Actions: []hapitypes.ActionConfig{{Verb: "color", Device: "lamp", Color: "red"}},
+			},
+		},
+	}
+
+	start := func(statefile hapitypes.Statefile) *Application {
+		app := newApplication(logex.Discard, nil, clock)
+		app.spawn = func(fn func()) { fn() }
+
+		assert.Assert(t, configureApp(app, conf, statefile, logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+		return app
+	}
+
+	restart := func(app *Application) *Application {
+		statefile, err := app.snapshotState()
+		assert.Assert(t, err == nil)
+
+		return start(statefile)
+	}
+
+	fired := func(app *Application, at time.Duration) int {
+		clock.AdvanceTo(t0.Add(at))
+
+		app.evaluateHeldStates()
+
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+
+		zigbee := app.adapterById["zigbee"]
+		count := len(zigbee.Outbound)
+		for len(zigbee.Outbound) > 0 {
+			<-zigbee.Outbound
+		}
+		return count
+	}
+
+	app := start(hapitypes.NewStatefile())
+	app.handleIncomingEvent(hapitypes.NewContactEvent("frontDoor", false, clock.Now()))
+	assert.Assert(t, fired(app, 5*time.Minute) == 0)
+
+	// door was opened before the restart
+	app = restart(app)
+	assert.Assert(t, fired(app, 9*time.Minute) == 0)
+	assert.Assert(t, fired(app, 10*time.Minute) == 1)
+
+	// and the episode doesn't fire again after another restart
+	app = restart(app)
+	assert.Assert(t, fired(app, 20*time.Minute) == 0)
+}
+
+func TestHeldStateValidation(t *testing.T) {
+	deviceById := map[string]*hapitypes.Device{"frontDoor": {}}
+
+	validate := func(conf hapitypes.HeldStateConfig) string {
+		_, err := newHeldStateTrigger(conf, deviceById)
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, validate(hapitypes.HeldStateConfig{Id: "open", Device: "frontDoor", State: "contact-open", DurationSeconds: 60}), "")
+	assert.EqualString(t, validate(hapitypes.HeldStateConfig{Id: "open", Device: "backDoor", State: "contact-open", DurationSeconds: 60}), "held open: device backDoor not found")
+	assert.EqualString(t, validate(hapitypes.HeldStateConfig{Id: "open", Device: "frontDoor", State: "ajar", DurationSeconds: 60}), "held open: unknown state: ajar")
+	assert.EqualString(t, validate(hapitypes.HeldStateConfig{Id: "open", Device: "frontDoor", State: "contact-open"}), "held open: duration_seconds must be positive")
+}
@@ -14,6 +14,26 @@ import (
 	"time"
 )
 
+const (
+	commandSourceHttp    = "http"
+	commandResultTimeout = 10 * time.Second
+)
+
+// /command is unauthenticated, so it only takes commands. sensor and presence reports would
+// let any client trigger automations
+var httpCommandTypes = map[string]bool{
+	"PowerEvent":            true,
+	"BrightnessEvent":       true,
+	"ColorMsg":              true,
+	"ColorTemperatureEvent": true,
+	"PlaybackEvent":         true,
+	"BlinkEvent":            true,
+	"InfraredEvent":         true,
+	"NotificationEvent":     true,
+	"SceneActivationEvent":  true,
+	"SceneCaptureEvent":     true,
+}
+
 const tpl = `
 <html>
 <head>
@@ -21,6 +41,8 @@ const tpl = `
 </head>
 <body>
 
+<p><a href="/explain">Policy decisions</a></p>
+
 <table>
 <thead>
 <tr>
@@ -34,11 +56,21 @@ const tpl = `
 </tr>
 </thead>
 <tbody>
-{{range .}}
+{{range .Areas}}
+{{if .Name}}
+<tr>
+	<th colspan="7">{{.Name}}</th>
+</tr>
+{{end}}
+{{range .Devices}}
 <tr>
 	<td>{{.Device.ProbablyTurnedOn}}</td>
 	<td>{{.Device.Conf.DeviceId}}</td>
+{{if .Device.GroupMembers}}
+	<td>group of {{range $i, $member := .Device.GroupMembers}}{{if $i}}, {{end}}{{$member}}{{end}}</td>
+{{else}}
 	<td>{{.Device.DeviceType.Manufacturer}} {{.Device.DeviceType.Model}}</td>
+{{end}}
 {{if .Device.DeviceType.BatteryType}}
 	<td title="type: {{.Device.DeviceType.BatteryType}} voltage: {{.Device.BatteryVoltage}} mV">{{.Device.BatteryPct}} %</td>
 {{else}}
@@ -53,8 +85,190 @@ const tpl = `
 	{{end}}</td>
 </tr>
 {{end}}
+{{end}}
+</tbody>
+</table>
+
+{{if .PowerDrift}}
+<h2>Power not confirmed by device</h2>
+
+<table>
+<thead>
+<tr>
+	<th>device</th>
+	<th>commanded</th>
+	<th>reported</th>
+	<th>attempts</th>
+	<th>next retry</th>
+</tr>
+</thead>
+<tbody>
+{{range .PowerDrift}}
+<tr>
+	<td>{{.Device}}</td>
+	<td>{{if .Commanded}}on{{else}}off{{end}}</td>
+	<td>{{if .Confirmed}}on{{else}}off{{end}}</td>
+	<td>{{.Attempts}}</td>
+	<td>{{if .GaveUp}}gave up{{else if .NextRetry.IsZero}}soon{{else}}{{.NextRetry.Format "15:04:05"}}{{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+
+{{if .Persons}}
+<h2>Persons</h2>
+
+<table>
+<thead>
+<tr>
+	<th>person</th>
+	<th>present</th>
+	<th>since</th>
+	<th>sources</th>
+</tr>
+</thead>
+<tbody>
+{{range .Persons}}
+<tr>
+	<td>{{.Id}}</td>
+	<td>{{.Present}}{{if .LeavingAt}} (leaving at {{.LeavingAt.Format "15:04:05"}}){{end}}</td>
+	<td>{{if .LastChange.IsZero}}unknown{{else}}{{.LastChange.Format "2006-01-02 15:04:05"}}{{end}}</td>
+	<td>{{range $source, $present := .Sources}}{{$source}}={{$present}} {{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+
+<h2>Booleans</h2>
+
+<table>
+<thead>
+<tr>
+	<th>name</th>
+	<th>value</th>
+	<th>last change</th>
+	<th>persisted</th>
+</tr>
+</thead>
+<tbody>
+{{range .Booleans}}
+<tr>
+	<td>{{.Name}}</td>
+	<td>{{.Value}}</td>
+	<td>{{if .LastChange.IsZero}}never{{else}}{{.LastChange.Format "2006-01-02 15:04:05"}}{{end}}</td>
+	<td>{{if .Persisted}}yes{{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+
+{{if .Variables}}
+<h2>Variables</h2>
+
+<table>
+<thead>
+<tr>
+	<th>name</th>
+	<th>type</th>
+	<th>value</th>
+	<th>last change</th>
+</tr>
+</thead>
+<tbody>
+{{range .Variables}}
+<tr>
+	<td>{{.Name}}</td>
+	<td>{{.Type}}</td>
+	<td>{{.Value}}</td>
+	<td>{{if .LastChange.IsZero}}never{{else}}{{.LastChange.Format "2006-01-02 15:04:05"}}{{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+
+{{if .Sequences}}
+<h2>Running action sequences</h2>
+
+<table>
+<thead>
+<tr>
+	<th>name</th>
+	<th>triggered by</th>
+	<th>started</th>
+	<th>step</th>
+	<th>sleeping until</th>
+</tr>
+</thead>
+<tbody>
+{{range .Sequences}}
+<tr>
+	<td>{{.Name}}</td>
+	<td>{{.Trigger}}</td>
+	<td>{{.Started.Format "15:04:05"}}</td>
+	<td>{{.Step}} / {{.Steps}}</td>
+	<td>{{if .SleepingUntil}}{{.SleepingUntil.Format "15:04:05"}}{{end}}</td>
+</tr>
+{{end}}
 </tbody>
 </table>
+{{end}}
+
+{{if .Schedules}}
+<h2>Schedules</h2>
+
+<table>
+<thead>
+<tr>
+	<th>event</th>
+	<th>next</th>
+	<th>last fired</th>
+</tr>
+</thead>
+<tbody>
+{{range .Schedules}}
+<tr>
+	<td>{{.Event}}</td>
+	<td>{{if .Next.IsZero}}never{{else}}{{.Next.Format "2006-01-02 15:04:05"}}{{end}}</td>
+	<td>{{if .LastFired}}{{.LastFired.Format "2006-01-02 15:04:05"}}{{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+
+{{if .RejectionCounts}}
+<h2>Rejected inbound events</h2>
+
+<ul>
+{{range .RejectionCounts}}
+	<li>{{.Reason}}: {{.Count}}</li>
+{{end}}
+</ul>
+
+<table>
+<thead>
+<tr>
+	<th>when</th>
+	<th>source</th>
+	<th>type</th>
+	<th>reason</th>
+</tr>
+</thead>
+<tbody>
+{{range .RecentRejections}}
+<tr>
+	<td>{{.When.Format "2006-01-02 15:04:05"}}</td>
+	<td>{{.Source}}</td>
+	<td>{{.Type}}</td>
+	<td>{{.Message}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
 
 </body>
 </html>
@@ -82,6 +296,87 @@ func handleHttp(app *Application, conf *hapitypes.ConfigFile, logger *log.Logger
 
 	http.Handle("/metrics", promhttp.Handler())
 
+	// latest policy decision trace per device. filter with ?device=kitchenLight
+	http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		deviceId := r.URL.Query().Get("device")
+		policyId := r.URL.Query().Get("policy")
+
+		// a device has a decision from each policy that controls it
+		decisions := []policyDecision{}
+		for _, decision := range app.policyEngine.latestDecisions() {
+			if (deviceId == "" || decision.Device == deviceId) && (policyId == "" || decision.Policy == policyId) {
+				decisions = append(decisions, decision)
+			}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(decisions)
+	})
+
+	// dispatches an inbound event and waits for the resulting command's outcome. body:
+	// {"type": "PowerEvent", "event": {"DeviceIdOrDeviceGroupId": "kitchenLight", "Kind": 0, "Explicit": true}} (Kind 0 = on)
+	http.HandleFunc("/command", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "expecting POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := struct {
+			Type  string          `json:"type"`
+			Event json.RawMessage `json:"event"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !httpCommandTypes[req.Type] {
+			http.Error(w, "not a command: "+req.Type, http.StatusBadRequest)
+			return
+		}
+
+		e, err := hapitypes.UnmarshalInboundEvent(req.Type, req.Event)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// templates can read any device's state
+		if notification, is := e.(*hapitypes.NotificationEvent); is {
+			notification.TemplateTrigger = ""
+		}
+
+		correlationId := hapitypes.NewCorrelationId()
+		e.Meta().CorrelationId = correlationId
+
+		results, unsubscribe := app.inbound.Results.Subscribe(correlationId)
+		defer unsubscribe()
+
+		app.inbound.ReceiveFrom(commandSourceHttp, e)
+
+		// device groups, scenes and areas have a result per device
+		collected, complete := hapitypes.CollectCommandResults(results, commandResultTimeout)
+
+		switch {
+		case !complete:
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case !allSucceeded(collected):
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(collected)
+	})
+
+	// activate and capture scenes via /command (SceneActivationEvent, SceneCaptureEvent)
+	http.HandleFunc("/scenes", func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(app.scenes.All())
+	})
+
 	http.HandleFunc("/ui", func(w http.ResponseWriter, r *http.Request) {
 		tmpl, err := template.New("name").Parse(tpl)
 		if err != nil {
@@ -106,7 +401,7 @@ func handleHttp(app *Application, conf *hapitypes.ConfigFile, logger *log.Logger
 
 		now := time.Now()
 
-		devicesComputed := []DeviceWithComputed{}
+		devicesByArea := map[string][]DeviceWithComputed{}
 		for _, device := range devices {
 			lastOnlineFormatted := ""
 
@@ -114,13 +409,51 @@ func handleHttp(app *Application, conf *hapitypes.ConfigFile, logger *log.Logger
 				lastOnlineFormatted = now.Sub(*device.LastOnline).String()
 			}
 
-			devicesComputed = append(devicesComputed, DeviceWithComputed{
+			devicesByArea[device.Conf.Area] = append(devicesByArea[device.Conf.Area], DeviceWithComputed{
 				Device:              device,
 				LastOnlineFormatted: lastOnlineFormatted,
 			})
 		}
 
-		if err := tmpl.Execute(w, devicesComputed); err != nil {
+		type AreaWithDevices struct {
+			Name    string // empty for devices not in any area
+			Devices []DeviceWithComputed
+		}
+
+		// areas in config order, devices without area last
+		areas := []AreaWithDevices{}
+		for _, area := range app.areas.areas {
+			if areaDevices, has := devicesByArea[area.Id]; has {
+				areas = append(areas, AreaWithDevices{app.areas.Name(area.Id), areaDevices})
+			}
+		}
+		if unassigned, has := devicesByArea[""]; has {
+			areas = append(areas, AreaWithDevices{"", unassigned})
+		}
+
+		rejectionCounts, recentRejections := app.rejections.snapshot()
+
+		if err := tmpl.Execute(w, struct {
+			Areas            []AreaWithDevices
+			PowerDrift       []powerDriftStatus
+			Persons          []personStatus
+			Booleans         []booleanStatus
+			Variables        []variableStatus
+			Sequences        []actionSequenceStatus
+			Schedules        []scheduleStatus
+			RejectionCounts  []rejectionCount
+			RecentRejections []inboundRejection
+		}{
+			Areas:            areas,
+			PowerDrift:       app.powerManager.Drift(),
+			Persons:          app.persons.Statuses(),
+			Booleans:         app.booleans.Statuses(),
+			Variables:        app.variables.Statuses(),
+			Sequences:        app.sequences.Statuses(),
+			Schedules:        app.schedules.Statuses(),
+			RejectionCounts:  rejectionCounts,
+			RecentRejections: recentRejections,
+		}); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -132,3 +465,13 @@ func handleHttp(app *Application, conf *hapitypes.ConfigFile, logger *log.Logger
 		logl.Error.Printf("ListenAndServe(): %s", err.Error())
 	}
 }
+
+func allSucceeded(results []hapitypes.CommandResult) bool {
+	for _, result := range results {
+		if !result.Succeeded() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	rejectReasonUnknownDevice         = "unknown-device"
+	rejectReasonUnsupportedCapability = "unsupported-capability"
+	rejectReasonUnknownPerson         = "unknown-person"
+)
+
+const recentRejectionsMax = 20
+
+type inboundRejection struct {
+	When    time.Time
+	Source  string // adapter id (or "hub")
+	Type    string // f.ex. "BrightnessEvent"
+	Reason  string
+	Message string
+}
+
+type rejectionCount struct {
+	Reason string
+	Count  int
+}
+
+// keeps track of inbound events that failed validation, so bad events (f.ex. stale device
+// ids from Alexa or typos in actions) show up in the UI instead of crashing the hub
+type inboundRejections struct {
+	counts  map[string]int
+	recent  []inboundRejection // newest first
+	metric  *prometheus.CounterVec
+	countMu sync.Mutex
+}
+
+func newInboundRejections() *inboundRejections {
+	return &inboundRejections{
+		counts: map[string]int{},
+		recent: []inboundRejection{},
+		metric: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hautomo_inbound_rejected_total",
+			Help: "Inbound events that failed validation",
+		}, []string{"reason"}),
+	}
+}
+
+func (r *inboundRejections) record(rejection inboundRejection) {
+	r.countMu.Lock()
+	defer r.countMu.Unlock()
+
+	r.counts[rejection.Reason]++
+	r.metric.WithLabelValues(rejection.Reason).Inc()
+
+	r.recent = append([]inboundRejection{rejection}, r.recent...)
+	if len(r.recent) > recentRejectionsMax {
+		r.recent = r.recent[:recentRejectionsMax]
+	}
+}
+
+func (r *inboundRejections) snapshot() ([]rejectionCount, []inboundRejection) {
+	r.countMu.Lock()
+	defer r.countMu.Unlock()
+
+	counts := []rejectionCount{}
+	for reason, count := range r.counts {
+		counts = append(counts, rejectionCount{Reason: reason, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Reason < counts[j].Reason
+	})
+
+	recent := make([]inboundRejection, len(r.recent))
+	copy(recent, r.recent)
+
+	return counts, recent
+}
+
+// checks that the event's target device (or person, or area) exists and supports the command. returns reason
+// and human readable message if the event should not be dispatched.
+func (a *Application) validateInboundEvent(inboundEvent hapitypes.InboundEvent) (string, string) {
+	if presence, is := inboundEvent.(*hapitypes.PersonPresenceChangeEvent); is {
+		if !a.persons.Has(presence.PersonId) {
+			return rejectReasonUnknownPerson, fmt.Sprintf("person %s not found", presence.PersonId)
+		}
+
+		return "", ""
+	}
+
+	deviceId, capability := inboundEventTarget(inboundEvent)
+	if deviceId == "" { // event not targeted at a device
+		return "", ""
+	}
+
+	if a.areas.Has(deviceId) {
+		// only commands can be fanned out to area's devices. whether any of them support the
+		// command is reported as the command's result
+		if capability == "" {
+			return rejectReasonUnsupportedCapability, fmt.Sprintf(
+				"area %s does not support %s",
+				deviceId,
+				inboundEvent.InboundEventType())
+		}
+
+		return "", ""
+	}
+
+	device, found := a.deviceById[deviceId]
+	if !found {
+		return rejectReasonUnknownDevice, fmt.Sprintf("device %s not found", deviceId)
+	}
+
+	if capability != "" && !hasCapability(device.DeviceType.Capabilities, capability) {
+		return rejectReasonUnsupportedCapability, fmt.Sprintf(
+			"device %s (%s) does not support %s",
+			deviceId,
+			device.Conf.Type,
+			capability)
+	}
+
+	return "", ""
+}
+
+// returns device id the event is about, and the capability it requires (if any)
+func inboundEventTarget(inboundEvent hapitypes.InboundEvent) (string, string) {
+	switch e := inboundEvent.(type) {
+	case *hapitypes.PowerEvent:
+		return e.DeviceIdOrDeviceGroupId, "power"
+	case *hapitypes.PowerReportEvent:
+		return e.Device, "power"
+	case *hapitypes.BrightnessEvent:
+		return e.DeviceIdOrDeviceGroupId, "brightness"
+	case *hapitypes.ColorMsg:
+		return e.DeviceId, "color"
+	case *hapitypes.ColorTemperatureEvent:
+		return e.Device, "colortemperature"
+	case *hapitypes.PlaybackEvent:
+		return e.Device, "playback"
+	case *hapitypes.BlinkEvent:
+		return e.DeviceId, ""
+	case *hapitypes.NotificationEvent:
+		return e.Device, ""
+	case *hapitypes.InfraredEvent:
+		return e.Device, ""
+	case *hapitypes.MotionEvent:
+		return e.Device, ""
+	case *hapitypes.ContactEvent:
+		return e.Device, ""
+	case *hapitypes.VibrationEvent:
+		return e.Device, ""
+	case *hapitypes.PushButtonEvent:
+		return e.Device, ""
+	case *hapitypes.WaterLeakEvent:
+		return e.Device, ""
+	case *hapitypes.LinkQualityEvent:
+		return e.Device, ""
+	case *hapitypes.BatteryStatusEvent:
+		return e.Device, ""
+	case *hapitypes.TemperatureHumidityPressureEvent:
+		return e.Device, ""
+	default:
+		return "", ""
+	}
+}
+
+// capability names match Capabilities' JSON keys
+func hasCapability(caps hapitypes.Capabilities, capability string) bool {
+	switch capability {
+	case "power":
+		return caps.Power
+	case "brightness":
+		return caps.Brightness
+	case "color":
+		return caps.Color
+	case "colortemperature":
+		return caps.ColorTemperature
+	case "playback":
+		return caps.Playback
+	default:
+		return false
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestInboundEventValidation(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "plug", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug"},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	// these used to panic the hub
+	app.handleIncomingEvent(hapitypes.NewBrightnessEvent("plug", 50))
+	app.handleIncomingEvent(hapitypes.NewPowerEvent("stalePlug", hapitypes.PowerKindOn, true))
+	app.handleIncomingEvent(hapitypes.NewMotionEvent("typo", true, 0))
+
+	app.handleIncomingEvent(hapitypes.NewPowerEvent("plug", hapitypes.PowerKindOn, true))
+	app.handleIncomingEvent(hapitypes.NewPublishEvent("custom:topic"))
+
+	counts, recent := app.rejections.snapshot()
+
+	assert.Assert(t, len(counts) == 2)
+	assert.EqualString(t, counts[0].Reason, "unknown-device")
+	assert.Assert(t, counts[0].Count == 2)
+	assert.EqualString(t, counts[1].Reason, "unsupported-capability")
+	assert.Assert(t, counts[1].Count == 1)
+
+	assert.Assert(t, len(recent) == 3)
+	assert.EqualString(t, recent[0].Message, "device typo not found")
+	assert.EqualString(t, recent[2].Message, "device plug (ikea-trådfri-smartplug) does not support brightness")
+}
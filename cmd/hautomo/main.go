@@ -18,6 +18,8 @@ func main() {
 		Version: dynversion.Version,
 	}
 	rootCmd.AddCommand(serverEntry())
+	rootCmd.AddCommand(eventsEntry())
+	rootCmd.AddCommand(replayEntry())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -26,6 +28,8 @@ func main() {
 }
 
 func serverEntry() *cobra.Command {
+	dryRun := false
+
 	server := &cobra.Command{
 		Use:   "server",
 		Short: "Starts the server",
@@ -41,21 +45,26 @@ func serverEntry() *cobra.Command {
 				workers.StopAllWorkersAndWait()
 			}(logex.Levels(logex.Prefix("main", rootLogger)))
 
-			if err := runServer(rootLogger, workers.Stopper()); err != nil {
+			if err := runServer(rootLogger, dryRun, workers.Stopper()); err != nil {
 				panic(err)
 			}
 		},
 	}
+	server.Flags().BoolVarP(&dryRun, "dry-run", "", dryRun, "Run inbound adapters normally, but only log outbound messages instead of sending them")
 
 	server.AddCommand(&cobra.Command{
 		Use:   "lint",
-		Short: "Verifies the syntax of the configuration file",
+		Short: "Verifies the configuration file (syntax, references and notification templates)",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			_, err := readConfigurationFile()
+			conf, err := readConfigurationFile()
 			if err != nil {
 				panic(err)
 			}
+
+			if err := lintNotifyTemplates(conf); err != nil {
+				panic(err)
+			}
 		},
 	})
 
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"text/template"
+	"time"
+)
+
+// what notification message templates see, like "humidity {{ .Device.bathroomSensor.Humidity }}%"
+type notifyTemplateData struct {
+	Event    string                          // topic that triggered the action
+	Device   map[string]notifyTemplateDevice // keyed by device id
+	Boolean  map[string]bool
+	Variable map[string]string
+	Person   map[string]bool // presence keyed by person id
+}
+
+// no pointers, so templates don't blow up on state we haven't received yet
+type notifyTemplateDevice struct {
+	Id               string
+	Name             string
+	ProbablyTurnedOn bool
+	LastColor        hapitypes.RGB
+	LastBrightness   uint
+	Temperature      float64
+	Humidity         float64
+	Pressure         float64
+	LastContact      hapitypes.ContactEvent // .Contact true = closed
+	LastMotion       time.Time
+	LastOnline       time.Time
+	LinkQuality      uint
+	BatteryPct       uint
+}
+
+func parseNotifyTemplate(message string) (*template.Template, error) {
+	return template.New("notify").Option("missingkey=error").Parse(message)
+}
+
+func renderNotifyMessage(message string, data notifyTemplateData) (string, error) {
+	tpl, err := parseNotifyTemplate(message)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := &bytes.Buffer{}
+	if err := tpl.Execute(rendered, data); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
+
+// must be called from the main loop, because it reads device state
+func (a *Application) renderNotifyTemplate(message string, trigger string) string {
+	rendered, err := renderNotifyMessage(message, a.notifyTemplateData(trigger))
+	if err != nil {
+		// better to get the unrendered message than nothing at all
+		a.logl.Error.Printf("notify template: %v", err)
+		return message
+	}
+
+	return rendered
+}
+
+func (a *Application) notifyTemplateData(trigger string) notifyTemplateData {
+	data := notifyTemplateData{
+		Event:    trigger,
+		Device:   map[string]notifyTemplateDevice{},
+		Boolean:  a.booleans.All(),
+		Variable: a.variables.All(),
+		Person:   a.persons.All(),
+	}
+
+	for id, device := range a.deviceById {
+		templateDevice := notifyTemplateDevice{
+			Id:               id,
+			Name:             device.Conf.Name,
+			ProbablyTurnedOn: device.ProbablyTurnedOn,
+			LastColor:        device.LastColor,
+			LastBrightness:   device.LastBrightness,
+			LinkQuality:      device.LinkQuality,
+			BatteryPct:       device.BatteryPct,
+		}
+
+		if thp := device.LastTemperatureHumidityPressureEvent; thp != nil {
+			templateDevice.Temperature = thp.Temperature
+			templateDevice.Humidity = thp.Humidity
+			templateDevice.Pressure = thp.Pressure
+		}
+
+		if device.LastContact != nil {
+			templateDevice.LastContact = *device.LastContact
+		}
+
+		if device.LastMotion != nil {
+			templateDevice.LastMotion = *device.LastMotion
+		}
+
+		if device.LastOnline != nil {
+			templateDevice.LastOnline = *device.LastOnline
+		}
+
+		data.Device[id] = templateDevice
+	}
+
+	return data
+}
+
+// renders notification templates against the (fresh) state of a non-started hub, so typos
+// in device ids, booleans and field names are caught before they matter
+func lintNotifyTemplates(conf *hapitypes.ConfigFile) error {
+	app := newApplication(logex.Discard, nil, realClock{})
+
+	if err := configureApp(app, conf, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error {
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	data := app.notifyTemplateData("lint")
+
+	for _, subscription := range conf.Subscriptions {
+		for _, action := range subscription.Actions {
+			if action.Verb != "notify" {
+				continue
+			}
+
+			if _, err := renderNotifyMessage(action.NotifyMessage, data); err != nil {
+				return fmt.Errorf("subscription %s: notify: %v", subscription.Event, err)
+			}
+		}
+	}
+
+	return nil
+}
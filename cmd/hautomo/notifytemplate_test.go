@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyTemplate(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, notifyTestConfig(
+		`Bathroom humidity {{ .Device.bathroomSensor.Humidity }}%, door {{ if .Device.frontDoor.LastContact.Contact }}closed{{else}}open{{end}} ({{ .Event }}, home={{ .Boolean.anybodyHome }}, joonas={{ .Person.joonas }})`,
+	), hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	app.handleIncomingEvent(hapitypes.NewTemperatureHumidityPressureEvent("bathroomSensor", 22.5, 71.5, 1000))
+	app.handleIncomingEvent(hapitypes.NewContactEvent("frontDoor", true, app.clock.Now()))
+	app.handleIncomingEvent(hapitypes.NewPersonPresenceChangeEvent("joonas", true))
+	app.handleIncomingEvent(hapitypes.NewPushButtonEvent("remote", "on"))
+
+	// action's sequence doesn't read device state, the main loop renders the template
+	notification := <-app.inbound.Ch
+	assert.EqualString(t, notification.(*hapitypes.NotificationEvent).TemplateTrigger, "pushbutton:remote:on")
+
+	app.handleIncomingEvent(hapitypes.NewTemperatureHumidityPressureEvent("bathroomSensor", 22.5, 72.0, 1000))
+	app.handleIncomingEvent(notification)
+
+	assert.EqualString(
+		t,
+		(<-app.adapterById["zigbee"].Outbound).(*hapitypes.NotificationEvent).Message,
+		"Bathroom humidity 72%, door closed (pushbutton:remote:on, home=true, joonas=true)")
+}
+
+func TestLintNotifyTemplates(t *testing.T) {
+	lint := func(message string) string {
+		if err := lintNotifyTemplates(notifyTestConfig(message)); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	// state we haven't received yet renders as zero values
+	assert.EqualString(t, lint("door {{ .Device.frontDoor.LastContact.Contact }}"), "")
+
+	lintErrorContains := func(message string, expected string) {
+		t.Helper()
+
+		err := lint(message)
+		assert.Assert(t, strings.HasPrefix(err, "subscription pushbutton:remote:on: notify: "))
+		assert.Assert(t, strings.Contains(err, expected))
+	}
+
+	lintErrorContains("{{ .Device.bathroomSensr.Humidity }}", `map has no entry for key "bathroomSensr"`)
+	lintErrorContains("{{ .Device.bathroomSensor.Humidty }}", "can't evaluate field Humidty")
+	lintErrorContains("{{ .Boolean.anybodyHom }}", `map has no entry for key "anybodyHom"`)
+	lintErrorContains("{{ if .Boolean.anybodyHome }}", "unexpected EOF")
+}
+
+func notifyTestConfig(message string) *hapitypes.ConfigFile {
+	return &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "bathroomSensor", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "aqara-temperature-humidity"},
+			{DeviceId: "frontDoor", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "aqara-doorwindow"},
+			{DeviceId: "remote", AdapterId: "zigbee", AdaptersDeviceId: "0x03", Type: "ikea-trådfri-remote"},
+			{DeviceId: "phone", AdapterId: "zigbee", AdaptersDeviceId: "0x04", Type: "ikea-trådfri-remote"},
+		},
+		Persons: []hapitypes.Person{
+			{Id: "joonas"},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event: "pushbutton:remote:on",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "notify", Device: "phone", NotifyMessage: message},
+				},
+			},
+		},
+	}
+}
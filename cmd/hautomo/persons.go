@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// person's presence is fused from several sources (ping, PC activity, phone geofence..). any
+// source seeing the person makes them present immediately, but they're considered away only
+// after all sources have said so for the away delay (phones drop off WiFi when sleeping etc.)
+type personRegistry struct {
+	persons map[string]*person
+	mu      sync.Mutex
+}
+
+type person struct {
+	conf       hapitypes.Person
+	sources    map[string]bool // presence by source
+	present    bool
+	lastChange time.Time
+	leavingAt  *time.Time // set when all sources say away, but away delay hasn't passed
+}
+
+// for UI
+type personStatus struct {
+	Id         string
+	Present    bool
+	LastChange time.Time
+	LeavingAt  *time.Time
+	Sources    map[string]bool
+}
+
+func newPersonRegistry() *personRegistry {
+	return &personRegistry{
+		persons: map[string]*person{},
+	}
+}
+
+func (p *personRegistry) Register(conf hapitypes.Person, snapshot *hapitypes.PersonSnapshot) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conf.Id == "" {
+		return fmt.Errorf("person without id")
+	}
+
+	if _, exists := p.persons[conf.Id]; exists {
+		return fmt.Errorf("duplicate person %s", conf.Id)
+	}
+
+	registered := &person{
+		conf:    conf,
+		sources: map[string]bool{},
+		// until sources tell otherwise, so policies don't act as if nobody's home
+		present: true,
+	}
+
+	if snapshot != nil {
+		registered.present = snapshot.Present
+		registered.lastChange = snapshot.LastChange
+	}
+
+	p.persons[conf.Id] = registered
+
+	return nil
+}
+
+// returns true if person's (fused) presence changed
+func (p *personRegistry) Report(personId string, source string, present bool, now time.Time) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	person, err := p.get(personId)
+	if err != nil {
+		return false, err
+	}
+
+	person.sources[source] = present
+
+	if person.anySourcePresent() {
+		person.leavingAt = nil
+
+		return p.change(person, true, now), nil
+	}
+
+	if !person.present || person.leavingAt != nil {
+		return false, nil
+	}
+
+	awayDelay := time.Duration(person.conf.AwayDelaySeconds) * time.Second
+	if awayDelay == 0 {
+		return p.change(person, false, now), nil
+	}
+
+	leavingAt := now.Add(awayDelay)
+	person.leavingAt = &leavingAt
+
+	return false, nil
+}
+
+// returns ids of persons whose away delay has passed (= they left)
+func (p *personRegistry) Evaluate(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	left := []string{}
+
+	for id, person := range p.persons {
+		if person.leavingAt == nil || person.leavingAt.After(now) {
+			continue
+		}
+
+		person.leavingAt = nil
+
+		if p.change(person, false, now) {
+			left = append(left, id)
+		}
+	}
+
+	sort.Strings(left)
+
+	return left
+}
+
+// second return is false if person is not registered
+func (p *personRegistry) IsPresent(personId string) (bool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	person, found := p.persons[personId]
+	if !found {
+		return false, false
+	}
+
+	return person.present, true
+}
+
+func (p *personRegistry) Has(personId string) bool {
+	_, found := p.IsPresent(personId)
+	return found
+}
+
+// second return is false if there are no persons (and thus we can't know)
+func (p *personRegistry) AnybodyHome() (bool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, person := range p.persons {
+		if person.present {
+			return true, true
+		}
+	}
+
+	return false, len(p.persons) > 0
+}
+
+// presence keyed by person id
+func (p *personRegistry) All() map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	presence := map[string]bool{}
+	for id, person := range p.persons {
+		presence[id] = person.present
+	}
+
+	return presence
+}
+
+func (p *personRegistry) Snapshot() map[string]hapitypes.PersonSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := map[string]hapitypes.PersonSnapshot{}
+	for id, person := range p.persons {
+		snapshot[id] = hapitypes.PersonSnapshot{
+			Present:    person.present,
+			LastChange: person.lastChange,
+		}
+	}
+
+	return snapshot
+}
+
+func (p *personRegistry) Statuses() []personStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := []personStatus{}
+	for id, person := range p.persons {
+		sources := map[string]bool{}
+		for source, present := range person.sources {
+			sources[source] = present
+		}
+
+		statuses = append(statuses, personStatus{
+			Id:         id,
+			Present:    person.present,
+			LastChange: person.lastChange,
+			LeavingAt:  person.leavingAt,
+			Sources:    sources,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Id < statuses[j].Id
+	})
+
+	return statuses
+}
+
+// must be called with mu held
+func (p *personRegistry) get(personId string) (*person, error) {
+	person, found := p.persons[personId]
+	if !found {
+		return nil, fmt.Errorf("person %s not found", personId)
+	}
+
+	return person, nil
+}
+
+func (p *personRegistry) change(person *person, present bool, now time.Time) bool {
+	if person.present == present {
+		return false
+	}
+
+	person.present = present
+	person.lastChange = now
+
+	return true
+}
+
+func (p *person) anySourcePresent() bool {
+	for _, present := range p.sources {
+		if present {
+			return true
+		}
+	}
+
+	return false
+}
+
+// called from main loop's ticker
+func (a *Application) evaluatePresence() {
+	for _, personId := range a.persons.Evaluate(a.clock.Now()) {
+		a.personPresenceChanged(personId, false)
+	}
+}
+
+func (a *Application) personPresenceChanged(personId string, present bool) {
+	if present {
+		a.logl.Info.Printf("%s arrived", personId)
+		a.publish(fmt.Sprintf("person:%s:arrived", personId))
+	} else {
+		a.logl.Info.Printf("%s left", personId)
+		a.publish(fmt.Sprintf("person:%s:left", personId))
+	}
+
+	anybodyHome, _ := a.persons.AnybodyHome()
+
+	changed, err := a.booleans.Set("anybodyHome", anybodyHome)
+	if err != nil {
+		a.logl.Error.Printf("anybodyHome: %v", err)
+		return
+	}
+
+	if changed {
+		a.publish(booleanChangeTopic("anybodyHome", anybodyHome))
+
+		if anybodyHome {
+			a.publish("presence:first-arrived")
+		} else {
+			a.publish("presence:last-left")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestPresenceDrivesAnybodyHome(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+	clock := newSimulatedClock(t0)
+
+	app := newApplication(logex.Discard, nil, clock)
+	app.spawn = func(fn func()) { fn() }
+
+	statefile := hapitypes.NewStatefile()
+	statefile.Persons["joonas"] = hapitypes.PersonSnapshot{Present: true}
+	statefile.Persons["mari"] = hapitypes.PersonSnapshot{Present: false}
+
+	// published presence topics are recorded as setVariable actions
+	recordTopic := func(topic string) hapitypes.SubscribeConfig {
+		return hapitypes.SubscribeConfig{
+			Event:   topic,
+			Actions: []hapitypes.ActionConfig{{Verb: "setVariable", Variable: "lastPresenceEvent", Value: topic}},
+		}
+	}
+
+	presenceTopics := []string{
+		"person:joonas:arrived",
+		"person:joonas:left",
+		"person:mari:arrived",
+		"person:mari:left",
+		"presence:first-arrived",
+		"presence:last-left",
+	}
+
+	subscriptions := []hapitypes.SubscribeConfig{
+		{
+			// like any other boolean change
+			Event:   "boolean:anybodyHome:*",
+			Actions: []hapitypes.ActionConfig{{Verb: "incrementVariable", Variable: "anybodyHomeChanges"}},
+		},
+	}
+	for _, topic := range presenceTopics {
+		subscriptions = append(subscriptions, recordTopic(topic))
+	}
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Persons: []hapitypes.Person{
+			{Id: "joonas", AwayDelaySeconds: 600},
+			{Id: "mari"},
+		},
+		Variables: []hapitypes.VariableConfig{
+			{Id: "lastPresenceEvent", Type: "enum", Values: append([]string{"none"}, presenceTopics...)},
+			{Id: "anybodyHomeChanges", Type: "counter"},
+		},
+		Subscriptions: subscriptions,
+	}, statefile, logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	anybodyHome := func() bool {
+		val, err := app.booleans.Get("anybodyHome")
+		assert.Assert(t, err == nil)
+		return val
+	}
+
+	lastEvent := func() string {
+		val, err := app.variables.Get("lastPresenceEvent")
+		assert.Assert(t, err == nil)
+		return val
+	}
+
+	report := func(person string, via string, present bool) {
+		e := hapitypes.NewPersonPresenceChangeEvent(person, present)
+		e.Via = via
+		app.handleIncomingEvent(e)
+	}
+
+	tick := func(at time.Duration) {
+		clock.AdvanceTo(t0.Add(at))
+		app.evaluatePresence()
+	}
+
+	// restored from statefile
+	assert.Assert(t, anybodyHome())
+
+	// phone sleeps, but laptop still sees joonas
+	report("joonas", "phone", true)
+	report("joonas", "laptop", true)
+	report("joonas", "phone", false)
+	tick(time.Hour)
+	assert.Assert(t, anybodyHome())
+	assert.EqualString(t, lastEvent(), "none")
+
+	// all sources say away, but away delay hasn't passed
+	report("joonas", "laptop", false)
+	tick(time.Hour + 9*time.Minute)
+	assert.Assert(t, anybodyHome())
+
+	// back within away delay = never left
+	report("joonas", "phone", true)
+	tick(time.Hour + 11*time.Minute)
+	assert.Assert(t, anybodyHome())
+	assert.EqualString(t, lastEvent(), "none")
+
+	report("joonas", "phone", false)
+	tick(time.Hour + 20*time.Minute)
+	assert.Assert(t, anybodyHome())
+	tick(time.Hour + 21*time.Minute)
+	assert.Assert(t, !anybodyHome())
+	assert.EqualString(t, lastEvent(), "presence:last-left")
+
+	present, _ := app.persons.IsPresent("joonas")
+	assert.Assert(t, !present)
+
+	// no away delay for mari
+	report("mari", "phone", true)
+	assert.Assert(t, anybodyHome())
+	assert.EqualString(t, lastEvent(), "presence:first-arrived")
+
+	report("mari", "phone", false)
+	assert.Assert(t, !anybodyHome())
+	assert.EqualString(t, lastEvent(), "presence:last-left")
+
+	assert.Assert(t, !app.persons.Snapshot()["mari"].Present)
+
+	changes, err := app.variables.Get("anybodyHomeChanges")
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, changes, "3")
+}
+
+func TestUnknownPersonRejected(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Persons: []hapitypes.Person{{Id: "joonas"}},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	reason, message := app.validateInboundEvent(hapitypes.NewPersonPresenceChangeEvent("mari", true))
+	assert.EqualString(t, reason, "unknown-person")
+	assert.EqualString(t, message, "person mari not found")
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"github.com/function61/gokit/logex"
 	"github.com/function61/hautomo/pkg/hapitypes"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -12,34 +16,101 @@ var (
 
 // policy idea: https://twitter.com/bradfitz/status/1056736707477819392
 type policyEngine struct {
-	booleans *booleanStorage
+	booleans    *booleanStorage
+	policies    []*occupancyPolicy
+	logl        *logex.Leveled
+	clock       clock
+	decisions   map[policyDecisionKey]policyDecision // latest decisions
+	decisionsMu sync.Mutex
+}
 
-	// control group
-	kitchenLight        *hapitypes.Device
-	kitchenMotionSensor *hapitypes.Device
+// a light can be controlled by more than one policy
+type policyDecisionKey struct {
+	policy string
+	device string
+}
 
-	// control group
-	bathroomCabinetLight *hapitypes.Device
-	bathroomMotionSensor *hapitypes.Device
-	bathroomDoor         *hapitypes.Device
+// trace of a single policy evaluation, so one can find out why a light is (not) on
+type policyDecision struct {
+	Policy    string            `json:"policy"`
+	Device    string            `json:"device"`
+	Evaluated time.Time         `json:"evaluated"`
+	Inputs    map[string]string `json:"inputs"` // only the inputs that were consulted
+	Rule      string            `json:"rule"`   // rule that made the decision
+	Result    string            `json:"result"` // on | off | no-op
+}
 
-	// control group
-	mirrorLight         *hapitypes.Device
-	bedroomMotionSensor *hapitypes.Device
+// control group of lights driven by motion sensors (and optionally an egress door)
+type occupancyPolicy struct {
+	conf          hapitypes.PolicyConfig
+	lights        []*hapitypes.Device
+	motionSensors []*hapitypes.Device
+	egressContact *hapitypes.Device // nil if not configured
 }
 
 // obtain won't be called after this ctor returns
-func newPolicyEngine(booleans *booleanStorage, obtain func(key string) *hapitypes.Device) *policyEngine {
-	return &policyEngine{
-		booleans:             booleans,
-		kitchenLight:         obtain("kitchenLight"),
-		kitchenMotionSensor:  obtain("kitchenMotion"),
-		bathroomCabinetLight: obtain("bathroomCabinetLight"),
-		bathroomMotionSensor: obtain("bathroomMotion"),
-		bathroomDoor:         obtain("bathroomDoor"),
-		mirrorLight:          obtain("mirrorLight"),
-		bedroomMotionSensor:  obtain("bedroomMotion"),
+func newPolicyEngine(
+	booleans *booleanStorage,
+	policyConfs []hapitypes.PolicyConfig,
+	obtain func(key string) *hapitypes.Device,
+	clock clock,
+	logl *logex.Leveled,
+) (*policyEngine, error) {
+	obtainAll := func(policyId string, deviceIds []string) ([]*hapitypes.Device, error) {
+		devices := []*hapitypes.Device{}
+
+		for _, deviceId := range deviceIds {
+			device := obtain(deviceId)
+			if device == nil {
+				return nil, fmt.Errorf("policy %s: device %s not found", policyId, deviceId)
+			}
+
+			devices = append(devices, device)
+		}
+
+		return devices, nil
+	}
+
+	policies := []*occupancyPolicy{}
+
+	for _, policyConf := range policyConfs {
+		if len(policyConf.Lights) == 0 || len(policyConf.MotionSensors) == 0 {
+			return nil, fmt.Errorf("policy %s: needs at least one light and motion sensor", policyConf.Id)
+		}
+
+		lights, err := obtainAll(policyConf.Id, policyConf.Lights)
+		if err != nil {
+			return nil, err
+		}
+
+		motionSensors, err := obtainAll(policyConf.Id, policyConf.MotionSensors)
+		if err != nil {
+			return nil, err
+		}
+
+		var egressContact *hapitypes.Device
+		if policyConf.EgressContact != "" {
+			egressContact = obtain(policyConf.EgressContact)
+			if egressContact == nil {
+				return nil, fmt.Errorf("policy %s: device %s not found", policyConf.Id, policyConf.EgressContact)
+			}
+		}
+
+		policies = append(policies, &occupancyPolicy{
+			conf:          policyConf,
+			lights:        lights,
+			motionSensors: motionSensors,
+			egressContact: egressContact,
+		})
 	}
+
+	return &policyEngine{
+		booleans:  booleans,
+		policies:  policies,
+		logl:      logl,
+		clock:     clock,
+		decisions: map[policyDecisionKey]policyDecision{},
+	}, nil
 }
 
 func (p *policyEngine) evaluatePowerPolicies(powerManager *PowerManager) {
@@ -51,111 +122,165 @@ func (p *policyEngine) evaluatePowerPolicies(powerManager *PowerManager) {
 		}
 	}
 
-	on := p.shouldKitchenLightBeOn()
-	if on != nil { // is nil if we don't want to act
-		powerManager.Set("kitchenLight", boolToPowerKind(*on))
+	for _, policy := range p.policies {
+		for _, light := range policy.lights {
+			on, decision := p.shouldLightBeOn(policy, light)
+
+			p.recordDecision(decision)
+
+			if on != nil { // is nil if we don't want to act
+				powerManager.Set(light.Conf.DeviceId, boolToPowerKind(*on))
+			}
+		}
 	}
+}
 
-	on = p.shouldBathroomCabinetLightBeOn()
-	if on != nil { // is nil if we don't want to act
-		powerManager.Set("bathroomCabinetLight", boolToPowerKind(*on))
+func (p *policyEngine) shouldLightBeOn(policy *occupancyPolicy, light *hapitypes.Device) (*bool, policyDecision) {
+	now := p.clock.Now()
+
+	decision := policyDecision{
+		Policy:    policy.conf.Id,
+		Device:    light.Conf.DeviceId,
+		Evaluated: now,
+		Inputs:    map[string]string{},
 	}
 
-	on = p.shouldMirrorLightBeOn()
-	if on != nil { // is nil if we don't want to act
-		powerManager.Set("mirrorLight", boolToPowerKind(*on))
+	decided := func(rule string, on *bool) (*bool, policyDecision) {
+		decision.Rule = rule
+		decision.Result = powerDecisionToString(on)
+		return on, decision
 	}
-}
 
-func (p *policyEngine) shouldKitchenLightBeOn() *bool {
-	now := time.Now()
+	decision.Inputs["lastExplicitPowerEvent"] = formatTimeOrNever(light.LastExplicitPowerEvent)
 
-	if p.kitchenLight.LastExplicitPowerEvent != nil {
-		fifteenMinutesAgo := now.Add(-15 * time.Minute)
+	if light.LastExplicitPowerEvent != nil {
+		overrideStarted := now.Add(-time.Duration(policy.conf.ManualOverrideSeconds) * time.Second)
 
-		if p.kitchenLight.LastExplicitPowerEvent.After(fifteenMinutesAgo) {
-			return nil
+		if light.LastExplicitPowerEvent.After(overrideStarted) {
+			return decided(fmt.Sprintf("explicit power event within %ds", policy.conf.ManualOverrideSeconds), nil)
 		}
 	}
 
-	if anybodyHome, _ := p.booleans.Get("anybodyHome"); !anybodyHome {
-		return falsep
-	}
+	if policy.conf.RequireAnybodyHome {
+		anybodyHome, _ := p.booleans.Get("anybodyHome")
+		decision.Inputs["anybodyHome"] = fmt.Sprintf("%v", anybodyHome)
 
-	if environmentHasLight, _ := p.booleans.Get("environmentHasLight"); environmentHasLight {
-		return falsep
+		if !anybodyHome {
+			return decided("nobody home", falsep)
+		}
 	}
 
-	lastMotion := p.kitchenMotionSensor.LastMotion
-	if lastMotion == nil {
-		return falsep
+	if policy.conf.RequireDarkness {
+		environmentHasLight, _ := p.booleans.Get("environmentHasLight")
+		decision.Inputs["environmentHasLight"] = fmt.Sprintf("%v", environmentHasLight)
+
+		if environmentHasLight {
+			return decided("environment has light", falsep)
+		}
 	}
 
-	twoMinutesAgo := now.Add(-2 * time.Minute)
+	lastMotion := policy.lastMotion()
+	decision.Inputs["lastMotion"] = formatTimeOrNever(lastMotion)
 
-	return bptr(lastMotion.After(twoMinutesAgo))
-}
+	if lastMotion == nil {
+		return decided("no motion ever", falsep)
+	}
 
-func (p *policyEngine) shouldBathroomCabinetLightBeOn() *bool {
-	now := time.Now()
+	// light should remain on if door was closed and movement detected after that (= it
+	// means that someone must be present in the room since that contact sensor is the only egress)
+	if policy.egressContact != nil {
+		dayAgo := now.Add(-24 * time.Hour)
 
-	if p.bathroomCabinetLight.LastExplicitPowerEvent != nil {
-		fifteenMinutesAgo := now.Add(-15 * time.Minute)
+		lastContact := policy.egressContact.LastContact
+		if lastContact != nil {
+			decision.Inputs["egressContact"] = fmt.Sprintf("%v @ %s", lastContact.Contact, formatTimeOrNever(&lastContact.When))
+		} else {
+			decision.Inputs["egressContact"] = "never"
+		}
 
-		if p.bathroomCabinetLight.LastExplicitPowerEvent.After(fifteenMinutesAgo) {
-			return nil
+		if lastContact != nil && lastContact.Contact && lastContact.When.After(dayAgo) && lastMotion.After(lastContact.When) {
+			return decided("motion after egress closed", truep)
 		}
 	}
 
-	if anybodyHome, _ := p.booleans.Get("anybodyHome"); !anybodyHome {
-		return falsep
-	}
+	timeoutStarted := now.Add(-time.Duration(policy.conf.OnTimeoutSeconds) * time.Second)
 
-	lastMotion := p.bathroomMotionSensor.LastMotion
-	if lastMotion == nil {
-		return falsep
+	if lastMotion.After(timeoutStarted) {
+		return decided(fmt.Sprintf("motion within %ds", policy.conf.OnTimeoutSeconds), truep)
 	}
 
-	threeMinutesAgo := now.Add(-5 * time.Minute)
-	dayAgo := now.Add(-24 * time.Hour)
+	return decided(fmt.Sprintf("no motion within %ds", policy.conf.OnTimeoutSeconds), falsep)
+}
+
+func (p *policyEngine) recordDecision(decision policyDecision) {
+	p.decisionsMu.Lock()
+	defer p.decisionsMu.Unlock()
 
-	// light should remain on if door was closed and movement detected after that (= it
-	// means that someone must be present in the room since that contact sensor is the only egress)
-	lastContact := p.bathroomDoor.LastContact
-	if lastContact != nil && lastContact.Contact && lastContact.When.After(dayAgo) && lastMotion.After(lastContact.When) {
-		return truep
+	key := policyDecisionKey{decision.Policy, decision.Device}
+
+	previous, hadPrevious := p.decisions[key]
+	if !hadPrevious || previous.Result != decision.Result || previous.Rule != decision.Rule {
+		p.logl.Debug.Printf(
+			"policy %s: %s => %s (%s)",
+			decision.Policy,
+			decision.Device,
+			decision.Result,
+			decision.Rule)
 	}
 
-	return bptr(lastMotion.After(threeMinutesAgo))
+	p.decisions[key] = decision
 }
 
-func (p *policyEngine) shouldMirrorLightBeOn() *bool {
-	now := time.Now()
+func (p *policyEngine) latestDecisions() []policyDecision {
+	p.decisionsMu.Lock()
+	defer p.decisionsMu.Unlock()
 
-	if p.mirrorLight.LastExplicitPowerEvent != nil {
-		twelveHoursAgo := now.Add(-12 * time.Hour)
+	decisions := []policyDecision{}
+	for _, decision := range p.decisions {
+		decisions = append(decisions, decision)
+	}
 
-		if p.mirrorLight.LastExplicitPowerEvent.After(twelveHoursAgo) {
-			return nil
+	sort.Slice(decisions, func(i, j int) bool {
+		if decisions[i].Device != decisions[j].Device {
+			return decisions[i].Device < decisions[j].Device
 		}
-	}
 
-	if environmentHasLight, _ := p.booleans.Get("environmentHasLight"); environmentHasLight {
-		return falsep
-	}
+		return decisions[i].Policy < decisions[j].Policy
+	})
 
-	if anybodyHome, _ := p.booleans.Get("anybodyHome"); !anybodyHome {
-		return falsep
+	return decisions
+}
+
+// latest motion across all of the policy's motion sensors
+func (o *occupancyPolicy) lastMotion() *time.Time {
+	var latest *time.Time
+
+	for _, sensor := range o.motionSensors {
+		if sensor.LastMotion != nil && (latest == nil || sensor.LastMotion.After(*latest)) {
+			latest = sensor.LastMotion
+		}
 	}
 
-	lastMotion := p.bedroomMotionSensor.LastMotion
-	if lastMotion == nil {
-		return falsep
+	return latest
+}
+
+func powerDecisionToString(on *bool) string {
+	switch {
+	case on == nil:
+		return "no-op"
+	case *on:
+		return "on"
+	default:
+		return "off"
 	}
+}
 
-	threeMinutesAgo := now.Add(-3 * time.Minute)
+func formatTimeOrNever(ts *time.Time) string {
+	if ts == nil {
+		return "never"
+	}
 
-	return bptr(lastMotion.After(threeMinutesAgo))
+	return ts.Format(time.RFC3339)
 }
 
 func bptr(b bool) *bool {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestOccupancyPolicy(t *testing.T) {
+	light := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "bathroomLight"}}
+	motion := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "bathroomMotion"}}
+	door := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "bathroomDoor"}}
+
+	devices := map[string]*hapitypes.Device{
+		"bathroomLight":  light,
+		"bathroomMotion": motion,
+		"bathroomDoor":   door,
+	}
+
+	booleans := NewBooleanStorage(realClock{}, "anybodyHome", "environmentHasLight")
+	_, _ = booleans.Set("anybodyHome", true)
+
+	engine, err := newPolicyEngine(booleans, []hapitypes.PolicyConfig{
+		{
+			Id:                    "bathroom",
+			Lights:                []string{"bathroomLight"},
+			MotionSensors:         []string{"bathroomMotion"},
+			EgressContact:         "bathroomDoor",
+			OnTimeoutSeconds:      300,
+			ManualOverrideSeconds: 900,
+			RequireDarkness:       true,
+			RequireAnybodyHome:    true,
+		},
+	}, func(key string) *hapitypes.Device {
+		return devices[key]
+	}, realClock{}, logex.Levels(logex.Discard))
+	assert.Assert(t, err == nil)
+
+	policy := engine.policies[0]
+
+	evaluate := func() string {
+		on, decision := engine.shouldLightBeOn(policy, light)
+		assert.EqualString(t, decision.Result, powerDecisionToString(on))
+		return decision.Result + " (" + decision.Rule + ")"
+	}
+
+	ago := func(d time.Duration) *time.Time {
+		ts := time.Now().Add(-d)
+		return &ts
+	}
+
+	assert.EqualString(t, evaluate(), "off (no motion ever)")
+
+	motion.LastMotion = ago(1 * time.Minute)
+	assert.EqualString(t, evaluate(), "on (motion within 300s)")
+
+	motion.LastMotion = ago(6 * time.Minute)
+	assert.EqualString(t, evaluate(), "off (no motion within 300s)")
+
+	// door closed, and motion after that => someone's inside
+	door.LastContact = hapitypes.NewContactEvent("bathroomDoor", true, *ago(10 * time.Minute))
+	assert.EqualString(t, evaluate(), "on (motion after egress closed)")
+
+	_, _ = booleans.Set("environmentHasLight", true)
+	assert.EqualString(t, evaluate(), "off (environment has light)")
+	_, _ = booleans.Set("environmentHasLight", false)
+
+	_, _ = booleans.Set("anybodyHome", false)
+	assert.EqualString(t, evaluate(), "off (nobody home)")
+	_, _ = booleans.Set("anybodyHome", true)
+
+	light.LastExplicitPowerEvent = ago(1 * time.Minute)
+	assert.EqualString(t, evaluate(), "no-op (explicit power event within 900s)")
+}
+
+func TestPolicyWithUnknownDevice(t *testing.T) {
+	_, err := newPolicyEngine(NewBooleanStorage(realClock{}), []hapitypes.PolicyConfig{
+		{
+			Id:            "kitchen",
+			Lights:        []string{"kitchenLight"},
+			MotionSensors: []string{"kitchenMotion"},
+		},
+	}, func(key string) *hapitypes.Device {
+		return nil
+	}, realClock{}, logex.Levels(logex.Discard))
+
+	assert.EqualString(t, err.Error(), "policy kitchen: device kitchenLight not found")
+}
+
+func TestDecisionsOfPoliciesSharingLight(t *testing.T) {
+	light := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "hallwayLight"}}
+	hallwayMotion := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "hallwayMotion"}}
+	stairsMotion := &hapitypes.Device{Conf: hapitypes.DeviceConfig{DeviceId: "stairsMotion"}}
+
+	devices := map[string]*hapitypes.Device{
+		"hallwayLight":  light,
+		"hallwayMotion": hallwayMotion,
+		"stairsMotion":  stairsMotion,
+	}
+
+	engine, err := newPolicyEngine(NewBooleanStorage(realClock{}), []hapitypes.PolicyConfig{
+		{Id: "stairs", Lights: []string{"hallwayLight"}, MotionSensors: []string{"stairsMotion"}, OnTimeoutSeconds: 60},
+		{Id: "hallway", Lights: []string{"hallwayLight"}, MotionSensors: []string{"hallwayMotion"}, OnTimeoutSeconds: 60},
+	}, func(key string) *hapitypes.Device {
+		return devices[key]
+	}, realClock{}, logex.Levels(logex.Discard))
+	assert.Assert(t, err == nil)
+
+	now := time.Now()
+	hallwayMotion.LastMotion = &now
+
+	powerManager := NewPowerManager(realClock{})
+	powerManager.Register("hallwayLight", false)
+
+	engine.evaluatePowerPolicies(powerManager)
+
+	decisions := engine.latestDecisions()
+	assert.Assert(t, len(decisions) == 2)
+	assert.EqualString(t, decisions[0].Policy+": "+decisions[0].Result, "hallway: on")
+	assert.EqualString(t, decisions[1].Policy+": "+decisions[1].Result, "stairs: off")
+}
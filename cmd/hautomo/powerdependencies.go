@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"time"
+)
+
+// device (f.ex. amplifier) that dependents (TV, media PC) need powered on. reference counted:
+// first dependent turning on powers the device on, last one turning off powers it off
+type powerDependency struct {
+	device           string
+	dependents       []string
+	onDelay          time.Duration // dependents wait this long after device was powered on
+	offGrace         time.Duration
+	activeDependents int        // -1 = not yet known
+	offAt            *time.Time // last dependent turned off, grace period running
+}
+
+// returns error if device already has dependents declared, or if the dependency would form a cycle
+func (p *PowerManager) AddDependency(conf hapitypes.PowerDependencyConfig) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(conf.Dependents) == 0 {
+		return fmt.Errorf("power dependency %s: no dependents", conf.Device)
+	}
+
+	if _, exists := p.dependencies[conf.Device]; exists {
+		return fmt.Errorf("power dependency %s: declared twice", conf.Device)
+	}
+
+	for _, dependent := range conf.Dependents {
+		if dependent == conf.Device || p.dependsOn(conf.Device, dependent) {
+			return fmt.Errorf("power dependency %s: cycle via %s", conf.Device, dependent)
+		}
+	}
+
+	for _, dependent := range conf.Dependents {
+		p.providers[dependent] = append(p.providers[dependent], conf.Device)
+	}
+
+	p.dependencies[conf.Device] = &powerDependency{
+		device:           conf.Device,
+		dependents:       conf.Dependents,
+		onDelay:          time.Duration(conf.OnDelaySeconds) * time.Second,
+		offGrace:         time.Duration(conf.OffGraceSeconds) * time.Second,
+		activeDependents: -1,
+	}
+
+	return nil
+}
+
+// whether device (transitively) depends on provider. must be called with mu held
+func (p *PowerManager) dependsOn(device string, provider string) bool {
+	for _, directProvider := range p.providers[device] {
+		if directProvider == provider || p.dependsOn(directProvider, provider) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// adjusts providers' desired state from their dependents' desired states. only acts on
+// changes in dependent count, so a provider explicitly turned off stays off until the count
+// goes from zero to non-zero again. must be called with mu held
+func (p *PowerManager) resolveDependencies(now time.Time) {
+	// chains (TV -> amplifier -> power strip) take a pass per link
+	for pass := 0; pass <= len(p.dependencies); pass++ {
+		changed := false
+
+		for _, dependency := range p.dependencies {
+			if p.resolveDependency(dependency, now) {
+				changed = true
+			}
+		}
+
+		if !changed {
+			return
+		}
+	}
+}
+
+// returns true if provider's desired state changed. must be called with mu held
+func (p *PowerManager) resolveDependency(dependency *powerDependency, now time.Time) bool {
+	active := 0
+	for _, dependent := range dependency.dependents {
+		if p.desired[dependent] {
+			active++
+		}
+	}
+
+	previous := dependency.activeDependents
+	dependency.activeDependents = active
+
+	if previous == -1 { // first evaluation establishes the baseline
+		// dependents restored from the statefile as on still need their provider
+		if active > 0 && !p.desired[dependency.device] {
+			p.desired[dependency.device] = true
+			return true
+		}
+
+		return false
+	}
+
+	if active > 0 {
+		dependency.offAt = nil
+
+		if previous == 0 && !p.desired[dependency.device] {
+			p.desired[dependency.device] = true
+			return true
+		}
+
+		return false
+	}
+
+	if previous > 0 {
+		offAt := now.Add(dependency.offGrace)
+		dependency.offAt = &offAt
+	}
+
+	if dependency.offAt != nil && !now.Before(*dependency.offAt) {
+		dependency.offAt = nil
+
+		if p.desired[dependency.device] {
+			p.desired[dependency.device] = false
+			return true
+		}
+	}
+
+	return false
+}
+
+// dependent can't be powered on before its providers are on (and their on delay has passed).
+// goingOn has devices that are being powered on in the same diff. must be called with mu held
+func (p *PowerManager) waitsForProviders(device string, goingOn map[string]bool, now time.Time) bool {
+	for _, provider := range p.providers[device] {
+		onDelay := p.dependencies[provider].onDelay
+
+		if goingOn[provider] {
+			if onDelay > 0 || p.waitsForProviders(provider, goingOn, now) {
+				return true
+			}
+
+			continue
+		}
+
+		if !p.actual[provider] {
+			return true
+		}
+
+		// older switches fall out of the history, and by then the delay has surely passed
+		if switches := p.switchesWithinHour(provider, now); len(switches) > 0 {
+			if now.Sub(switches[len(switches)-1]) < onDelay {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// providers come before their dependents. must be called with mu held
+func (p *PowerManager) dependencyDepth(device string) int {
+	depth := 0
+	for _, provider := range p.providers[device] {
+		if providerDepth := p.dependencyDepth(provider) + 1; providerDepth > depth {
+			depth = providerDepth
+		}
+	}
+
+	return depth
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestPowerDependency(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC))
+	after := func(d time.Duration) {
+		clock.AdvanceTo(clock.Now().Add(d))
+	}
+
+	pm := NewPowerManager(clock)
+	pm.Register("amp", false)
+	pm.Register("tv", false)
+	pm.Register("pc", false)
+
+	assert.Assert(t, pm.AddDependency(hapitypes.PowerDependencyConfig{
+		Device:          "amp",
+		Dependents:      []string{"tv", "pc"},
+		OnDelaySeconds:  10,
+		OffGraceSeconds: 60,
+	}) == nil)
+
+	diffAndApply := func() string {
+		diff := pm.Diff()
+		for _, pd := range diff {
+			pm.ApplyDiff(pd)
+		}
+		return serialize(diff)
+	}
+
+	assert.EqualString(t, diffAndApply(), "")
+
+	// amp first, TV after amp's on delay
+	pm.Set("tv", hapitypes.PowerKindOn)
+	assert.EqualString(t, diffAndApply(), "amp => on")
+	after(5 * time.Second)
+	assert.EqualString(t, diffAndApply(), "")
+	after(5 * time.Second)
+	assert.EqualString(t, diffAndApply(), "tv => on")
+
+	// amp already on
+	pm.Set("pc", hapitypes.PowerKindOn)
+	assert.EqualString(t, diffAndApply(), "pc => on")
+
+	pm.Set("tv", hapitypes.PowerKindOff)
+	assert.EqualString(t, diffAndApply(), "tv => off")
+
+	// last dependent off => grace period
+	pm.Set("pc", hapitypes.PowerKindOff)
+	assert.EqualString(t, diffAndApply(), "pc => off")
+	after(30 * time.Second)
+	assert.EqualString(t, diffAndApply(), "")
+
+	// dependent back on within grace period cancels it
+	pm.Set("tv", hapitypes.PowerKindOn)
+	assert.EqualString(t, diffAndApply(), "tv => on")
+	after(45 * time.Second)
+	assert.EqualString(t, diffAndApply(), "")
+
+	pm.Set("tv", hapitypes.PowerKindOff)
+	assert.EqualString(t, diffAndApply(), "tv => off")
+	after(59 * time.Second)
+	assert.EqualString(t, diffAndApply(), "")
+	after(1 * time.Second)
+	assert.EqualString(t, diffAndApply(), "amp => off")
+
+	// amp explicitly turned off while a dependent is on => we don't fight it
+	pm.Set("tv", hapitypes.PowerKindOn)
+	assert.EqualString(t, diffAndApply(), "amp => on")
+	after(10 * time.Second)
+	assert.EqualString(t, diffAndApply(), "tv => on")
+	pm.SetExplicit("amp", hapitypes.PowerKindOff)
+	assert.EqualString(t, diffAndApply(), "amp => off")
+	after(5 * time.Second)
+	assert.EqualString(t, diffAndApply(), "")
+}
+
+func TestPowerDependencyChain(t *testing.T) {
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	pm.Register("tv", false)
+	pm.Register("amp", false)
+	pm.Register("strip", false)
+
+	assert.Assert(t, pm.AddDependency(hapitypes.PowerDependencyConfig{
+		Device:     "amp",
+		Dependents: []string{"tv"},
+	}) == nil)
+	assert.Assert(t, pm.AddDependency(hapitypes.PowerDependencyConfig{
+		Device:     "strip",
+		Dependents: []string{"amp"},
+	}) == nil)
+
+	assert.Assert(t, len(pm.Diff()) == 0)
+
+	pm.Set("tv", hapitypes.PowerKindOn)
+	diff := pm.Diff()
+	assert.EqualString(t, serialize(diff), "strip => on, amp => on, tv => on")
+	for _, pd := range diff {
+		pm.ApplyDiff(pd)
+	}
+
+	pm.Set("tv", hapitypes.PowerKindOff)
+	assert.EqualString(t, serialize(pm.Diff()), "strip => off, amp => off, tv => off")
+}
+
+func TestPowerDependencyAfterRestart(t *testing.T) {
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	pm.Register("tv", true) // restored from statefile
+	pm.Register("amp", false)
+	pm.Register("strip", false)
+
+	assert.Assert(t, pm.AddDependency(hapitypes.PowerDependencyConfig{
+		Device:     "amp",
+		Dependents: []string{"tv"},
+	}) == nil)
+	assert.Assert(t, pm.AddDependency(hapitypes.PowerDependencyConfig{
+		Device:     "strip",
+		Dependents: []string{"amp"},
+	}) == nil)
+
+	assert.EqualString(t, serialize(pm.Diff()), "strip => on, amp => on")
+}
+
+func TestPowerDependencyValidation(t *testing.T) {
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	add := func(device string, dependents ...string) string {
+		err := pm.AddDependency(hapitypes.PowerDependencyConfig{
+			Device:     device,
+			Dependents: dependents,
+		})
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, add("amp", "tv"), "")
+	assert.EqualString(t, add("strip", "amp"), "")
+	assert.EqualString(t, add("amp", "pc"), "power dependency amp: declared twice")
+	assert.EqualString(t, add("tv", "strip"), "power dependency tv: cycle via strip")
+	assert.EqualString(t, add("pc", "pc"), "power dependency pc: cycle via pc")
+	assert.EqualString(t, add("pc"), "power dependency pc: no dependents")
+}
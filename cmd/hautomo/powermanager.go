@@ -2,6 +2,21 @@ package main
 
 import (
 	"github.com/function61/hautomo/pkg/hapitypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	powerConfirmTimeout     = 10 * time.Second // doubles for each retry
+	powerConfirmMaxAttempts = 5                // including the original command
+)
+
+const (
+	powerSuppressedMinOnTime       = "min-on-time"
+	powerSuppressedMinOffTime      = "min-off-time"
+	powerSuppressedSwitchesPerHour = "max-switches-per-hour"
 )
 
 type PowerDiff struct {
@@ -9,39 +24,148 @@ type PowerDiff struct {
 	On     bool
 }
 
+// anti-flapping limits, so a noisy sensor can't toggle a relay over and over. zero = no limit
+type powerLimits struct {
+	minOnTime          time.Duration
+	minOffTime         time.Duration
+	maxSwitchesPerHour int
+}
+
+// change that was held back by device's limits
+type powerSuppression struct {
+	Device string
+	On     bool
+	Reason string
+}
+
 type PowerManager struct {
 	desired map[string]bool
-	actual  map[string]bool
+	actual  map[string]bool // last commanded. for devices that don't report their state, our best guess
+	// state reported by the device itself. only has devices that have ever reported
+	confirmed map[string]bool
+	pending   map[string]*pendingPower // commands not yet confirmed by device
+	limits    map[string]powerLimits
+	explicit  map[string]bool        // explicit commands bypass limits
+	switches  map[string][]time.Time // switch times within the last hour
+	// separate from switches, because min on/off times can be longer than an hour
+	lastSwitch map[string]time.Time
+	// currently suppressed, so we log & count each suppression only once (and not on every evaluation)
+	suppressed       map[string]powerSuppression
+	newSuppressions  []powerSuppression
+	suppressedMetric *prometheus.CounterVec
+	dependencies     map[string]*powerDependency // keyed by provider
+	providers        map[string][]string         // keyed by dependent
+	groupMembers     map[string][]string         // keyed by device group
+	clock            clock
+	mu               sync.Mutex
+}
+
+type pendingPower struct {
+	on        bool
+	attempts  int
+	nextRetry time.Time // zero until retry timer is started
+	gaveUp    bool
+}
+
+// for UI
+type powerDriftStatus struct {
+	Device    string
+	Commanded bool
+	Confirmed bool
+	Attempts  int
+	NextRetry time.Time
+	GaveUp    bool
 }
 
 // implements desired state reconciliation for controlling device's power
-func NewPowerManager() *PowerManager {
+func NewPowerManager(clock clock) *PowerManager {
 	return &PowerManager{
-		desired: map[string]bool{},
-		actual:  map[string]bool{},
+		desired:    map[string]bool{},
+		actual:     map[string]bool{},
+		confirmed:  map[string]bool{},
+		pending:    map[string]*pendingPower{},
+		limits:     map[string]powerLimits{},
+		explicit:   map[string]bool{},
+		switches:   map[string][]time.Time{},
+		lastSwitch: map[string]time.Time{},
+		suppressed: map[string]powerSuppression{},
+		suppressedMetric: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hautomo_power_suppressed_total",
+			Help: "Power changes held back by device's anti-flapping limits",
+		}, []string{"reason"}),
+		dependencies: map[string]*powerDependency{},
+		providers:    map[string][]string{},
+		groupMembers: map[string][]string{},
+		clock:        clock,
 	}
 }
 
+// for device groups: on if any member is on
 func (p *PowerManager) GetActual(deviceId string) bool {
-	return p.actual[deviceId]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.isOn(deviceId)
+}
+
+// must be called with mu held
+func (p *PowerManager) isOn(deviceId string) bool {
+	members, isGroup := p.groupMembers[deviceId]
+	if !isGroup {
+		return p.actual[deviceId]
+	}
+
+	for _, member := range members {
+		if p.isOn(member) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// members can be groups themselves (cycles must be checked by caller)
+func (p *PowerManager) SetGroupMembers(groupId string, members []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.groupMembers[groupId] = members
 }
 
 func (p *PowerManager) Register(deviceId string, isOn bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.desired[deviceId] = isOn
 	p.actual[deviceId] = isOn
 }
 
+func (p *PowerManager) SetLimits(deviceId string, limits powerLimits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.limits[deviceId] = limits
+}
+
 func (p *PowerManager) SetExplicit(deviceId string, power hapitypes.PowerKind) {
-	p.Set(deviceId, power)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.desired[deviceId] = p.getDesired(deviceId, power)
+	p.explicit[deviceId] = true
 
 	// for explicit sets, we want to always force a diff. this hack does it
 	p.actual[deviceId] = !p.desired[deviceId]
 }
 
 func (p *PowerManager) Set(deviceId string, power hapitypes.PowerKind) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.desired[deviceId] = p.getDesired(deviceId, power)
 }
 
+// must be called with mu held
 func (p *PowerManager) getDesired(deviceId string, power hapitypes.PowerKind) bool {
 	switch power {
 	case hapitypes.PowerKindOn:
@@ -49,24 +173,258 @@ func (p *PowerManager) getDesired(deviceId string, power hapitypes.PowerKind) bo
 	case hapitypes.PowerKindOff:
 		return false
 	case hapitypes.PowerKindToggle:
-		return !p.actual[deviceId]
+		return !p.isOn(deviceId)
 	default:
 		panic("unknown PowerKind")
 	}
 }
 
+// call after the diff's command was sent
 func (p *PowerManager) ApplyDiff(pd PowerDiff) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.actual[pd.Device] = pd.On
+	p.recordSwitch(pd.Device)
+
+	delete(p.explicit, pd.Device)
+	delete(p.pending, pd.Device)
+
+	// devices that have never reported their state are assumed to obey
+	if confirmed, reports := p.confirmed[pd.Device]; reports && confirmed != pd.On {
+		p.pending[pd.Device] = &pendingPower{
+			on:       pd.On,
+			attempts: 1,
+		}
+	}
 }
 
+// device reported its actual power state. returns true if the device was changed outside
+// of us (wall switch, vendor's app..), in which case we adopt the state instead of fighting it
+func (p *PowerManager) Report(deviceId string, isOn bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.confirmed[deviceId] = isOn
+
+	if pending, has := p.pending[deviceId]; has {
+		// if not yet what we asked for, it might be stale report from before our command
+		if pending.on == isOn {
+			delete(p.pending, deviceId)
+		}
+
+		return false
+	}
+
+	if p.actual[deviceId] == isOn {
+		return false
+	}
+
+	p.actual[deviceId] = isOn
+	p.desired[deviceId] = isOn
+	p.recordSwitch(deviceId)
+
+	return true
+}
+
+// returns commands that need to be re-sent because device didn't confirm them in time, and
+// devices whose commands we gave up on
+func (p *PowerManager) Retries(now time.Time) ([]PowerDiff, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	retries := []PowerDiff{}
+	gaveUp := []string{}
+
+	for deviceId, pending := range p.pending {
+		if pending.gaveUp {
+			continue
+		}
+
+		// timer starts on first evaluation, which happens right after the command was sent
+		if pending.nextRetry.IsZero() {
+			pending.nextRetry = now.Add(powerConfirmBackoff(pending.attempts))
+			continue
+		}
+
+		if now.Before(pending.nextRetry) {
+			continue
+		}
+
+		if pending.attempts >= powerConfirmMaxAttempts {
+			pending.gaveUp = true
+			gaveUp = append(gaveUp, deviceId)
+			continue
+		}
+
+		pending.attempts++
+		pending.nextRetry = now.Add(powerConfirmBackoff(pending.attempts))
+
+		retries = append(retries, PowerDiff{deviceId, pending.on})
+	}
+
+	sort.Slice(retries, func(i, j int) bool {
+		return retries[i].Device < retries[j].Device
+	})
+	sort.Strings(gaveUp)
+
+	return retries, gaveUp
+}
+
+// changes held back by limits are left out (see NewSuppressions())
 func (p *PowerManager) Diff() []PowerDiff {
-	diff := []PowerDiff{}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock.Now()
+
+	p.resolveDependencies(now)
+
+	candidates := []PowerDiff{}
+	goingOn := map[string]bool{}
+	suppressed := map[string]powerSuppression{}
+
 	for deviceId, isDesiredOn := range p.desired {
 		isActuallyOn := p.actual[deviceId]
-		if isDesiredOn != isActuallyOn {
-			diff = append(diff, PowerDiff{deviceId, isDesiredOn})
+		if isDesiredOn == isActuallyOn {
+			continue
+		}
+
+		if reason := p.limitExceeded(deviceId, now); reason != "" && !p.explicit[deviceId] {
+			suppression := powerSuppression{deviceId, isDesiredOn, reason}
+
+			if previous, was := p.suppressed[deviceId]; !was || previous != suppression {
+				p.newSuppressions = append(p.newSuppressions, suppression)
+				p.suppressedMetric.WithLabelValues(reason).Inc()
+			}
+
+			suppressed[deviceId] = suppression
+			continue
 		}
+
+		candidates = append(candidates, PowerDiff{deviceId, isDesiredOn})
+		goingOn[deviceId] = isDesiredOn
 	}
 
+	p.suppressed = suppressed
+
+	diff := []PowerDiff{}
+	for _, candidate := range candidates {
+		if candidate.On && p.waitsForProviders(candidate.Device, goingOn, now) {
+			continue // gets powered on in a later evaluation
+		}
+
+		diff = append(diff, candidate)
+	}
+
+	// deterministic order (map iteration is not), so replays are reproducible. providers first
+	sort.Slice(diff, func(i, j int) bool {
+		iDepth, jDepth := p.dependencyDepth(diff[i].Device), p.dependencyDepth(diff[j].Device)
+		if iDepth != jDepth {
+			return iDepth < jDepth
+		}
+
+		return diff[i].Device < diff[j].Device
+	})
+
 	return diff
 }
+
+// whether device's power is as desired (false if a change is waiting for limits or providers)
+func (p *PowerManager) IsSettled(deviceId string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.desired[deviceId] == p.actual[deviceId]
+}
+
+// suppressions that started since the last call
+func (p *PowerManager) NewSuppressions() []powerSuppression {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	suppressions := p.newSuppressions
+	p.newSuppressions = nil
+
+	sort.Slice(suppressions, func(i, j int) bool {
+		return suppressions[i].Device < suppressions[j].Device
+	})
+
+	return suppressions
+}
+
+// returns reason if changing device's power now would exceed its limits. must be called with mu held
+func (p *PowerManager) limitExceeded(deviceId string, now time.Time) string {
+	limits := p.limits[deviceId]
+
+	lastSwitch, hasSwitched := p.lastSwitch[deviceId]
+	if !hasSwitched {
+		return ""
+	}
+
+	sinceLastSwitch := now.Sub(lastSwitch)
+
+	if p.actual[deviceId] {
+		if sinceLastSwitch < limits.minOnTime {
+			return powerSuppressedMinOnTime
+		}
+	} else {
+		if sinceLastSwitch < limits.minOffTime {
+			return powerSuppressedMinOffTime
+		}
+	}
+
+	if limits.maxSwitchesPerHour > 0 && len(p.switchesWithinHour(deviceId, now)) >= limits.maxSwitchesPerHour {
+		return powerSuppressedSwitchesPerHour
+	}
+
+	return ""
+}
+
+// must be called with mu held
+func (p *PowerManager) recordSwitch(deviceId string) {
+	now := p.clock.Now()
+
+	p.switches[deviceId] = append(p.switchesWithinHour(deviceId, now), now)
+	p.lastSwitch[deviceId] = now
+}
+
+// must be called with mu held
+func (p *PowerManager) switchesWithinHour(deviceId string, now time.Time) []time.Time {
+	switches := p.switches[deviceId]
+
+	for len(switches) > 0 && now.Sub(switches[0]) >= time.Hour {
+		switches = switches[1:]
+	}
+
+	return switches
+}
+
+// devices whose confirmed state differs from what we commanded
+func (p *PowerManager) Drift() []powerDriftStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := []powerDriftStatus{}
+	for deviceId, pending := range p.pending {
+		statuses = append(statuses, powerDriftStatus{
+			Device:    deviceId,
+			Commanded: pending.on,
+			Confirmed: p.confirmed[deviceId],
+			Attempts:  pending.attempts,
+			NextRetry: pending.nextRetry,
+			GaveUp:    pending.gaveUp,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Device < statuses[j].Device
+	})
+
+	return statuses
+}
+
+// 10s, 20s, 40s, ..
+func powerConfirmBackoff(attempts int) time.Duration {
+	return powerConfirmTimeout << uint(attempts-1)
+}
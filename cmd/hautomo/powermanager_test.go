@@ -2,13 +2,15 @@ package main
 
 import (
 	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
 	"github.com/function61/hautomo/pkg/hapitypes"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPowerManager(t *testing.T) {
-	pm := NewPowerManager()
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
 	pm.Register("foo", false)
 	pm.Register("bar", false)
 
@@ -35,7 +37,7 @@ func TestPowerManager(t *testing.T) {
 }
 
 func TestPowerManagerWithExplicit(t *testing.T) {
-	pm := NewPowerManager()
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
 	pm.Register("dev", true)
 
 	pm.Set("dev", hapitypes.PowerKindOn) // should not do anything
@@ -54,6 +56,242 @@ func TestPowerManagerWithExplicit(t *testing.T) {
 	assert.EqualString(t, serialize(pm.Diff()), "dev => on")
 }
 
+func TestPowerManagerConfirmation(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return t0.Add(time.Duration(seconds) * time.Second)
+	}
+
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	pm.Register("silent", false)
+	pm.Register("reporter", false)
+
+	// devices that have never reported are trusted to obey
+	pm.Set("silent", hapitypes.PowerKindOn)
+	pm.ApplyDiff(pm.Diff()[0])
+	assert.Assert(t, len(pm.Drift()) == 0)
+
+	assert.Assert(t, pm.Report("reporter", false) == false)
+
+	pm.Set("reporter", hapitypes.PowerKindOn)
+	pm.ApplyDiff(pm.Diff()[0])
+	assert.Assert(t, pm.GetActual("reporter") == true)
+	assert.Assert(t, len(pm.Drift()) == 1)
+
+	retries, gaveUp := pm.Retries(at(0)) // starts timer
+	assert.Assert(t, len(retries) == 0 && len(gaveUp) == 0)
+
+	retries, _ = pm.Retries(at(5))
+	assert.Assert(t, len(retries) == 0)
+
+	retries, _ = pm.Retries(at(10))
+	assert.EqualString(t, serialize(retries), "reporter => on")
+
+	// backoff doubles
+	retries, _ = pm.Retries(at(25))
+	assert.Assert(t, len(retries) == 0)
+	retries, _ = pm.Retries(at(30))
+	assert.EqualString(t, serialize(retries), "reporter => on")
+
+	// stale report from before our command doesn't confirm
+	assert.Assert(t, pm.Report("reporter", false) == false)
+	assert.Assert(t, len(pm.Drift()) == 1)
+
+	assert.Assert(t, pm.Report("reporter", true) == false)
+	assert.Assert(t, len(pm.Drift()) == 0)
+
+	retries, _ = pm.Retries(at(1000))
+	assert.Assert(t, len(retries) == 0)
+}
+
+func TestPowerManagerGivesUp(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	pm.Register("dev", false)
+	pm.Report("dev", false)
+
+	pm.Set("dev", hapitypes.PowerKindOn)
+	pm.ApplyDiff(pm.Diff()[0])
+
+	sent := 1
+	gaveUpAt := time.Duration(0)
+	for elapsed := time.Duration(0); elapsed < 10*time.Minute; elapsed += 5 * time.Second {
+		retries, gaveUp := pm.Retries(t0.Add(elapsed))
+		sent += len(retries)
+
+		if len(gaveUp) > 0 {
+			assert.EqualString(t, gaveUp[0], "dev")
+			gaveUpAt = elapsed
+		}
+	}
+
+	assert.Assert(t, sent == powerConfirmMaxAttempts)
+	assert.EqualString(t, gaveUpAt.String(), "5m10s") // 10 + 20 + 40 + 80 + 160 seconds
+
+	drift := pm.Drift()
+	assert.Assert(t, len(drift) == 1 && drift[0].GaveUp)
+
+	// new command starts over
+	pm.Set("dev", hapitypes.PowerKindOff)
+	pm.ApplyDiff(pm.Diff()[0])
+	assert.Assert(t, len(pm.Drift()) == 0)
+}
+
+func TestPowerManagerAdoptsExternalChange(t *testing.T) {
+	pm := NewPowerManager(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	pm.Register("dev", false)
+
+	// somebody used the wall switch
+	assert.Assert(t, pm.Report("dev", true) == true)
+	assert.Assert(t, pm.GetActual("dev") == true)
+	assert.Assert(t, len(pm.Diff()) == 0) // we don't fight back
+
+	pm.Set("dev", hapitypes.PowerKindToggle)
+	assert.EqualString(t, serialize(pm.Diff()), "dev => off")
+}
+
+func TestPowerManagerLimits(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC))
+	after := func(d time.Duration) {
+		clock.AdvanceTo(clock.Now().Add(d))
+	}
+
+	pm := NewPowerManager(clock)
+	pm.Register("amp", false)
+	pm.SetLimits("amp", powerLimits{
+		minOnTime:          5 * time.Minute,
+		minOffTime:         1 * time.Minute,
+		maxSwitchesPerHour: 4,
+	})
+
+	// no switch history yet => no limits
+	pm.Set("amp", hapitypes.PowerKindOn)
+	pm.ApplyDiff(pm.Diff()[0])
+
+	after(1 * time.Minute)
+	pm.Set("amp", hapitypes.PowerKindOff)
+	assert.Assert(t, len(pm.Diff()) == 0)
+	assert.Assert(t, len(pm.Diff()) == 0)
+
+	// logged & counted only once, although evaluated twice
+	suppressions := pm.NewSuppressions()
+	assert.Assert(t, len(suppressions) == 1)
+	assert.EqualString(t, suppressions[0].Reason, "min-on-time")
+	assert.Assert(t, len(pm.NewSuppressions()) == 0)
+
+	// change wanted is no longer wanted => nothing suppressed
+	pm.Set("amp", hapitypes.PowerKindOn)
+	assert.Assert(t, len(pm.Diff()) == 0)
+
+	after(4 * time.Minute)
+	pm.Set("amp", hapitypes.PowerKindOff)
+	assert.EqualString(t, serialize(pm.Diff()), "amp => off")
+	pm.ApplyDiff(pm.Diff()[0])
+
+	after(30 * time.Second)
+	pm.Set("amp", hapitypes.PowerKindOn)
+	assert.Assert(t, len(pm.Diff()) == 0)
+	assert.EqualString(t, pm.NewSuppressions()[0].Reason, "min-off-time")
+
+	after(30 * time.Second)
+	pm.ApplyDiff(pm.Diff()[0]) // 3rd switch
+
+	after(5 * time.Minute)
+	pm.Set("amp", hapitypes.PowerKindOff)
+	pm.ApplyDiff(pm.Diff()[0]) // 4th switch
+
+	after(5 * time.Minute)
+	pm.Set("amp", hapitypes.PowerKindOn)
+	assert.Assert(t, len(pm.Diff()) == 0)
+	assert.EqualString(t, pm.NewSuppressions()[0].Reason, "max-switches-per-hour")
+
+	// explicit commands bypass limits
+	pm.SetExplicit("amp", hapitypes.PowerKindOn)
+	assert.EqualString(t, serialize(pm.Diff()), "amp => on")
+	pm.ApplyDiff(pm.Diff()[0])
+
+	// explicit switches count towards the limit, though
+	after(6 * time.Minute)
+	pm.Set("amp", hapitypes.PowerKindOff)
+	assert.Assert(t, len(pm.Diff()) == 0)
+
+	// first switch falls out of the hour window, but there's still four within the hour
+	after(39 * time.Minute)
+	assert.Assert(t, len(pm.Diff()) == 0)
+
+	// second too
+	after(4 * time.Minute)
+	assert.EqualString(t, serialize(pm.Diff()), "amp => off")
+}
+
+func TestPowerManagerLimitsLongerThanHour(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC))
+
+	pm := NewPowerManager(clock)
+	pm.Register("heater", false)
+	pm.SetLimits("heater", powerLimits{
+		minOffTime: 3 * time.Hour,
+	})
+
+	pm.Set("heater", hapitypes.PowerKindOn)
+	pm.ApplyDiff(pm.Diff()[0])
+	pm.Set("heater", hapitypes.PowerKindOff)
+	pm.ApplyDiff(pm.Diff()[0])
+
+	// switch has fallen out of the hour window, but min off time hasn't passed
+	clock.AdvanceTo(clock.Now().Add(2 * time.Hour))
+	pm.Set("heater", hapitypes.PowerKindOn)
+	assert.Assert(t, len(pm.Diff()) == 0)
+	assert.EqualString(t, pm.NewSuppressions()[0].Reason, "min-off-time")
+
+	clock.AdvanceTo(clock.Now().Add(1 * time.Hour))
+	assert.EqualString(t, serialize(pm.Diff()), "heater => on")
+}
+
+func TestPowerRetryIsSentToAdapter(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC))
+
+	app := newApplication(logex.Discard, nil, clock)
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "plug", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug"},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	handle := func(e hapitypes.InboundEvent) {
+		app.handleIncomingEvent(e)
+		app.applyPowerDiffs()
+	}
+
+	handle(hapitypes.NewPowerReportEvent("plug", false))
+
+	handle(hapitypes.NewPowerEvent("plug", hapitypes.PowerKindOn, true))
+	assert.Assert(t, (<-zigbee.Outbound).(*hapitypes.PowerMsg).On)
+
+	clock.AdvanceTo(clock.Now().Add(10 * time.Second))
+	app.applyPowerDiffs()
+
+	retry := (<-zigbee.Outbound).(*hapitypes.PowerMsg)
+	assert.Assert(t, retry.On)
+	assert.EqualString(t, retry.DeviceId, "0x01")
+
+	handle(hapitypes.NewPowerReportEvent("plug", true))
+	assert.Assert(t, len(app.powerManager.Drift()) == 0)
+
+	// turned off from the plug's button
+	handle(hapitypes.NewPowerReportEvent("plug", false))
+	assert.Assert(t, !app.deviceById["plug"].ProbablyTurnedOn)
+	assert.Assert(t, len(zigbee.Outbound) == 0)
+}
+
 func serialize(diffs []PowerDiff) string {
 	serialized := []string{}
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/eventjournal"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+func replayEntry() *cobra.Command {
+	return &cobra.Command{
+		Use:   "replay [journal]",
+		Short: "Feeds recorded inbound events through the hub on a simulated clock, printing resulting outbound messages",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, err := readConfigurationFile()
+			if err != nil {
+				panic(err)
+			}
+
+			if err := replay(args[0], conf, os.Stdout, logex.StandardLogger()); err != nil {
+				panic(err)
+			}
+		},
+	}
+}
+
+// adapters are not started. instead, after each step we drain outbound messages and print them.
+// the main loop's tickers are simulated in between recorded events.
+func replay(journalPath string, conf *hapitypes.ConfigFile, output io.Writer, logger *log.Logger) error {
+	recorded := []eventjournal.Entry{}
+	if err := eventjournal.Read(journalPath, logex.Levels(logex.Prefix("journal", logger)), func(entry eventjournal.Entry) error {
+		if entry.Kind == eventjournal.KindInbound {
+			recorded = append(recorded, entry)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(recorded) == 0 {
+		return errors.New("no inbound events in journal")
+	}
+
+	clock := newSimulatedClock(recorded[0].Timestamp)
+
+	app := newApplication(logex.Prefix("hub", logger), nil, clock)
+	app.spawn = func(fn func()) { fn() } // deterministic ordering
+	app.inbound.Ch = make(chan hapitypes.InboundEvent, 1024)
+
+	if err := configureApp(app, conf, hapitypes.NewStatefile(), logger, func(adapter *hapitypes.Adapter) error {
+		adapter.Outbound = make(chan hapitypes.OutboundEvent, 1024)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	adapterIds := []string{}
+	for id := range app.adapterById {
+		adapterIds = append(adapterIds, id)
+	}
+	sort.Strings(adapterIds)
+
+	printOutbound := func(adapterId string, e hapitypes.OutboundEvent) error {
+		eventJson, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(output, eventjournal.Entry{
+			Timestamp: clock.Now(),
+			Kind:      eventjournal.KindOutbound,
+			Source:    adapterId,
+			Type:      e.OutboundEventType(),
+			Event:     eventJson,
+		}.String())
+		return err
+	}
+
+	// process inbound & outbound queues until there's nothing left to do
+	settle := func() error {
+		for {
+			progressed := false
+
+			for _, adapterId := range adapterIds {
+				adapter := app.adapterById[adapterId]
+
+				for len(adapter.Outbound) > 0 {
+					progressed = true
+
+					e := <-adapter.Outbound
+
+					// device groups produce inbound events for their members (mirrors devicegroupadapter)
+					if adapter.Conf.Type == "devicegroup" {
+						for _, to := range adapter.Conf.DevicegroupDevices {
+							adapter.Receive(hapitypes.RedirectInboundCorrelated(e, to))
+						}
+						continue
+					}
+
+					if err := printOutbound(adapterId, e); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(app.inbound.Ch) > 0 {
+				progressed = true
+
+				app.handleIncomingEvent(<-app.inbound.Ch)
+				app.applyPowerDiffs()
+			}
+
+			if !progressed {
+				return nil
+			}
+		}
+	}
+
+	next5s := clock.Now().Add(5 * time.Second)
+	nextMinute := clock.Now().Add(1 * time.Minute)
+
+	// fires timers and main loop's tickers that are due before "to"
+	advanceTo := func(to time.Time) error {
+		for {
+			next := next5s
+			if nextMinute.Before(next) {
+				next = nextMinute
+			}
+			if timerAt, has := clock.NextTimer(); has && timerAt.Before(next) {
+				next = timerAt
+			}
+
+			if next.After(to) {
+				clock.AdvanceTo(to)
+				return settle()
+			}
+
+			clock.AdvanceTo(next)
+
+			if !next5s.After(next) {
+				app.evaluateHeldStates()
+				app.evaluatePresence()
+				app.evaluateSchedules()
+				app.applyPowerDiffs()
+				next5s = next5s.Add(5 * time.Second)
+			}
+
+			if !nextMinute.After(next) {
+				app.updateEnvironmentLightStatus(true)
+				nextMinute = nextMinute.Add(1 * time.Minute)
+			}
+
+			if err := settle(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, entry := range recorded {
+		// events generated by the hub or device groups get re-generated by the replay itself
+		if entry.Source == hapitypes.InboundSourceHub {
+			continue
+		}
+		if adapter, found := app.adapterById[entry.Source]; found && adapter.Conf.Type == "devicegroup" {
+			continue
+		}
+
+		event, err := hapitypes.UnmarshalInboundEvent(entry.Type, entry.Event)
+		if err != nil {
+			return err
+		}
+
+		event.Meta().When = entry.Timestamp
+		event.Meta().Source = entry.Source
+
+		if err := advanceTo(entry.Timestamp); err != nil {
+			return err
+		}
+
+		app.handleIncomingEvent(event)
+		app.applyPowerDiffs()
+
+		if err := settle(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
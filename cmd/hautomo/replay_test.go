@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/eventjournal"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	journalPath := filepath.Join(dir, "events.log")
+
+	journal, err := eventjournal.Open(journalPath, logex.Levels(logex.Discard))
+	assert.Assert(t, err == nil)
+
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+
+	record := func(ts time.Time, source string, e hapitypes.InboundEvent) {
+		eventJson, err := json.Marshal(e)
+		assert.Assert(t, err == nil)
+
+		assert.Assert(t, journal.Append(eventjournal.Entry{
+			Timestamp: ts,
+			Kind:      eventjournal.KindInbound,
+			Source:    source,
+			Type:      e.InboundEventType(),
+			Event:     eventJson,
+		}) == nil)
+	}
+
+	record(t0, "zigbee", hapitypes.NewMotionEvent("bathroomMotion", true, 0))
+	record(t0.Add(1*time.Second), "hub", hapitypes.NewPowerEvent("bathroomLight", hapitypes.PowerKindOn, false)) // ignored
+	record(t0.Add(10*time.Minute), "zigbee", hapitypes.NewLinkQualityEvent("bathroomMotion", 50))
+
+	assert.Assert(t, journal.Close() == nil)
+
+	conf := &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "bathroomLight", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-smartplug"},
+			{DeviceId: "bathroomMotion", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "aqara-motion-sensor"},
+		},
+		Policies: []hapitypes.PolicyConfig{
+			{
+				Id:                 "bathroom",
+				Lights:             []string{"bathroomLight"},
+				MotionSensors:      []string{"bathroomMotion"},
+				OnTimeoutSeconds:   120,
+				RequireAnybodyHome: true,
+			},
+		},
+	}
+
+	output := &bytes.Buffer{}
+
+	assert.Assert(t, replay(journalPath, conf, output, logex.Discard) == nil)
+
+	assert.EqualString(t, output.String(), `2019-11-03T03:00:00Z outbound zigbee       PowerMsg {"DeviceId":"0x01","PowerCommand":"","On":true}
+2019-11-03T03:02:00Z outbound zigbee       PowerMsg {"DeviceId":"0x01","PowerCommand":"","On":false}
+`)
+}
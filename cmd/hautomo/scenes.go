@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"sort"
+	"sync"
+)
+
+// config-defined and captured scenes. captured scenes are persisted in the statefile
+type sceneStorage struct {
+	scenes   map[string]hapitypes.SceneConfig
+	captured map[string]bool
+	mu       sync.Mutex
+}
+
+func newSceneStorage() *sceneStorage {
+	return &sceneStorage{
+		scenes:   map[string]hapitypes.SceneConfig{},
+		captured: map[string]bool{},
+	}
+}
+
+func (s *sceneStorage) Get(id string) (hapitypes.SceneConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scene, found := s.scenes[id]
+	return scene, found
+}
+
+func (s *sceneStorage) Define(scene hapitypes.SceneConfig, captured bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.scenes[scene.Id]; exists && !s.captured[scene.Id] {
+		if captured {
+			return fmt.Errorf("scene %s is defined in configuration", scene.Id)
+		}
+
+		return fmt.Errorf("duplicate scene id %s", scene.Id)
+	}
+
+	s.scenes[scene.Id] = scene
+	s.captured[scene.Id] = captured
+
+	return nil
+}
+
+func (s *sceneStorage) All() []hapitypes.SceneConfig {
+	return s.list(func(string) bool { return true })
+}
+
+func (s *sceneStorage) Captured() []hapitypes.SceneConfig {
+	return s.list(func(id string) bool { return s.captured[id] })
+}
+
+func (s *sceneStorage) list(include func(id string) bool) []hapitypes.SceneConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenes := []hapitypes.SceneConfig{}
+	for id, scene := range s.scenes {
+		if include(id) {
+			scenes = append(scenes, scene)
+		}
+	}
+
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].Id < scenes[j].Id
+	})
+
+	return scenes
+}
+
+func (a *Application) activateScene(e *hapitypes.SceneActivationEvent) error {
+	scene, found := a.scenes.Get(e.SceneId)
+	if !found {
+		return fmt.Errorf("scene %s not found", e.SceneId)
+	}
+
+	a.logl.Info.Printf("activating scene %s", scene.Id)
+
+	powerEvents := []hapitypes.InboundEvent{}
+	lightEvents := []hapitypes.InboundEvent{}
+
+	for _, sceneDevice := range scene.Devices {
+		switch sceneDevice.Power {
+		case "on":
+			powerEvents = append(powerEvents, hapitypes.NewPowerEvent(sceneDevice.Device, hapitypes.PowerKindOn, true))
+		case "off":
+			powerEvents = append(powerEvents, hapitypes.NewPowerEvent(sceneDevice.Device, hapitypes.PowerKindOff, true))
+			continue
+		}
+
+		if sceneDevice.Color != "" {
+			color, err := hapitypes.ParseColor(sceneDevice.Color)
+			if err != nil { // validated when scene was defined
+				return err
+			}
+
+			lightEvents = append(lightEvents, hapitypes.NewColorMsg(sceneDevice.Device, color))
+		}
+
+		if sceneDevice.ColorTemperature != 0 {
+			lightEvents = append(lightEvents, hapitypes.NewColorTemperatureEvent(sceneDevice.Device, sceneDevice.ColorTemperature))
+		}
+
+		if sceneDevice.Brightness != 0 {
+			lightEvents = append(lightEvents, hapitypes.NewBrightnessEvent(sceneDevice.Device, sceneDevice.Brightness))
+		}
+	}
+
+	// all sub-events report their results to the activation's originator
+	a.inbound.Results.FanOut(e.CorrelationId, len(powerEvents)+len(lightEvents))
+
+	handle := func(sub hapitypes.InboundEvent) {
+		sub.Meta().CorrelationId = e.CorrelationId
+		a.handleIncomingEvent(sub)
+	}
+
+	// power first, so lights are on before we adjust them
+	for _, powerEvent := range powerEvents {
+		handle(powerEvent)
+	}
+
+	a.applyPowerDiffs()
+
+	for _, lightEvent := range lightEvents {
+		handle(lightEvent)
+	}
+
+	return nil
+}
+
+func (a *Application) captureScene(e *hapitypes.SceneCaptureEvent) error {
+	if e.SceneId == "" || len(e.Devices) == 0 {
+		return errors.New("scene capture needs id and at least one device")
+	}
+
+	if err := a.validateSceneId(e.SceneId); err != nil {
+		return err
+	}
+
+	scene := hapitypes.SceneConfig{
+		Id:      e.SceneId,
+		Name:    e.Name,
+		Devices: []hapitypes.SceneDeviceConfig{},
+	}
+
+	for _, deviceId := range e.Devices {
+		device, found := a.deviceById[deviceId]
+		if !found {
+			return fmt.Errorf("scene %s: device %s not found", scene.Id, deviceId)
+		}
+
+		caps := device.DeviceType.Capabilities
+
+		sceneDevice := hapitypes.SceneDeviceConfig{Device: deviceId}
+
+		if caps.Power {
+			if device.ProbablyTurnedOn {
+				sceneDevice.Power = "on"
+			} else {
+				sceneDevice.Power = "off"
+			}
+		}
+
+		if sceneDevice.Power != "off" {
+			if caps.Brightness {
+				sceneDevice.Brightness = device.LastBrightness
+			}
+
+			if caps.ColorTemperature && device.LastColorTemperature != 0 {
+				sceneDevice.ColorTemperature = device.LastColorTemperature
+			} else if caps.Color {
+				sceneDevice.Color = device.LastColor.Hex()
+			}
+		}
+
+		scene.Devices = append(scene.Devices, sceneDevice)
+	}
+
+	if err := a.scenes.Define(scene, true); err != nil {
+		return err
+	}
+
+	a.logl.Info.Printf("captured scene %s", scene.Id)
+
+	return nil
+}
+
+// scenes are Alexa endpoints too, so their ids share namespace with devices (incl. device
+// groups) and areas
+func (a *Application) validateSceneId(sceneId string) error {
+	if _, isDevice := a.deviceById[sceneId]; isDevice {
+		return fmt.Errorf("scene %s: id clashes with a device", sceneId)
+	}
+
+	if a.areas.Has(sceneId) {
+		return fmt.Errorf("scene %s: id clashes with an area", sceneId)
+	}
+
+	return nil
+}
+
+func validateScene(scene hapitypes.SceneConfig, deviceById map[string]*hapitypes.Device) error {
+	if scene.Id == "" {
+		return errors.New("scene without id")
+	}
+
+	for _, sceneDevice := range scene.Devices {
+		device, found := deviceById[sceneDevice.Device]
+		if !found {
+			return fmt.Errorf("scene %s: device %s not found", scene.Id, sceneDevice.Device)
+		}
+
+		caps := device.DeviceType.Capabilities
+
+		unsupported := func(capability string) error {
+			return fmt.Errorf("scene %s: device %s does not support %s", scene.Id, sceneDevice.Device, capability)
+		}
+
+		switch sceneDevice.Power {
+		case "":
+		case "on", "off":
+			if !caps.Power {
+				return unsupported("power")
+			}
+		default:
+			return fmt.Errorf("scene %s: device %s: power must be on or off", scene.Id, sceneDevice.Device)
+		}
+
+		if sceneDevice.Brightness != 0 {
+			if !caps.Brightness {
+				return unsupported("brightness")
+			}
+
+			if sceneDevice.Brightness > 100 {
+				return fmt.Errorf("scene %s: device %s: brightness over 100 %%", scene.Id, sceneDevice.Device)
+			}
+		}
+
+		if sceneDevice.Color != "" {
+			if !caps.Color {
+				return unsupported("color")
+			}
+
+			if _, err := hapitypes.ParseColor(sceneDevice.Color); err != nil {
+				return fmt.Errorf("scene %s: device %s: %v", scene.Id, sceneDevice.Device, err)
+			}
+		}
+
+		if sceneDevice.ColorTemperature != 0 && !caps.ColorTemperature {
+			return unsupported("colortemperature")
+		}
+	}
+
+	return nil
+}
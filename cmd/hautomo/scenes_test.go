@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenes(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "plug", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-smartplug"},
+		},
+		Scenes: []hapitypes.SceneConfig{
+			{
+				Id:   "movie",
+				Name: "Movie night",
+				Devices: []hapitypes.SceneDeviceConfig{
+					{Device: "lamp", Power: "on", Brightness: 30, Color: "#ff8800"},
+					{Device: "plug", Power: "off"},
+				},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	sent := func() string {
+		msgs := []string{}
+		for len(zigbee.Outbound) > 0 {
+			switch e := (<-zigbee.Outbound).(type) {
+			case *hapitypes.PowerMsg:
+				msgs = append(msgs, fmt.Sprintf("power %s %v", e.DeviceId, e.On))
+			case *hapitypes.BrightnessMsg:
+				msgs = append(msgs, fmt.Sprintf("brightness %s %d", e.DeviceId, e.Brightness))
+			case *hapitypes.ColorMsg:
+				msgs = append(msgs, fmt.Sprintf("color %s %s", e.DeviceId, e.Color.Hex()))
+			}
+		}
+		return strings.Join(msgs, "; ")
+	}
+
+	app.powerManager.SetExplicit("plug", hapitypes.PowerKindOn)
+	app.applyPowerDiffs()
+	assert.EqualString(t, sent(), "power 0x02 true")
+
+	app.handleIncomingEvent(hapitypes.NewSceneActivationEvent("movie"))
+	app.applyPowerDiffs()
+	assert.EqualString(t, sent(), "power 0x01 true; power 0x02 false; color 0x01 #ff8800; brightness 0x01 30")
+
+	// capture current state and play it back after changes
+	app.handleIncomingEvent(hapitypes.NewSceneCaptureEvent("captured", "Captured", []string{"lamp", "plug"}))
+
+	captured, found := app.scenes.Get("captured")
+	assert.Assert(t, found)
+	assert.Assert(t, len(app.scenes.Captured()) == 1)
+	assert.EqualString(t, fmt.Sprintf("%v", captured.Devices), "[{lamp on 30 #ff8800 0} {plug off 0  0}]")
+
+	app.handleIncomingEvent(hapitypes.NewColorTemperatureEvent("lamp", 2700))
+	assert.EqualString(t, sent(), "")
+	app.handleIncomingEvent(hapitypes.NewSceneCaptureEvent("captured", "Captured", []string{"lamp"}))
+	captured, _ = app.scenes.Get("captured")
+	assert.EqualString(t, fmt.Sprintf("%v", captured.Devices), "[{lamp on 30  2700}]")
+
+	// config-defined scenes can't be overwritten
+	assert.EqualString(t, app.captureScene(hapitypes.NewSceneCaptureEvent("movie", "", []string{"lamp"})).Error(), "scene movie is defined in configuration")
+	assert.EqualString(t, app.captureScene(hapitypes.NewSceneCaptureEvent("plug", "", []string{"lamp"})).Error(), "scene plug: id clashes with a device")
+
+	assert.EqualString(t, validateScene(hapitypes.SceneConfig{
+		Id:      "bad",
+		Devices: []hapitypes.SceneDeviceConfig{{Device: "plug", Brightness: 50}},
+	}, app.deviceById).Error(), "scene bad: device plug does not support brightness")
+}
+
+func TestSceneIdClashes(t *testing.T) {
+	configure := func(sceneId string) string {
+		app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+		err := configureApp(app, &hapitypes.ConfigFile{
+			Adapters: []hapitypes.AdapterConfig{
+				{Id: "zigbee", Type: "zigbee2mqtt"},
+			},
+			Devices: []hapitypes.DeviceConfig{
+				{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb", Area: "kitchen"},
+			},
+			DeviceGroups: []hapitypes.DeviceGroupConfig{
+				{DeviceId: "lights", Devices: []string{"lamp"}},
+			},
+			Areas: []hapitypes.AreaConfig{
+				{Id: "kitchen"},
+			},
+			Scenes: []hapitypes.SceneConfig{
+				{Id: sceneId, Devices: []hapitypes.SceneDeviceConfig{{Device: "lamp", Power: "on"}}},
+			},
+		}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil })
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, configure("cooking"), "")
+	assert.EqualString(t, configure("lamp"), "scene lamp: id clashes with a device")
+	assert.EqualString(t, configure("lights"), "scene lights: id clashes with a device")
+	assert.EqualString(t, configure("kitchen"), "scene kitchen: id clashes with an area")
+}
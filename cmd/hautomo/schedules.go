@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/suntimes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// if we were down when a schedule was due, it still fires if we're back within this window
+const scheduleCatchUpWindow = 5 * time.Minute
+
+type scheduleSpec interface {
+	Next(after time.Time) time.Time // zero if never
+}
+
+// "sun:sunset-30m" = 30 minutes before sunset
+type sunSchedule struct {
+	event  string // one of suntimes.EventNames
+	offset time.Duration
+}
+
+func (s *sunSchedule) Next(after time.Time) time.Time {
+	// start from yesterday, since a negative offset can move tomorrow's event to today
+	for day := -1; day <= 366; day++ {
+		if at, happens := s.At(after.AddDate(0, 0, day)); happens && at.After(after) {
+			return at
+		}
+	}
+
+	return time.Time{}
+}
+
+// offset applied. false if the event doesn't happen that day
+func (s *sunSchedule) At(day time.Time) (time.Time, bool) {
+	at, happens := suntimes.TimesOfDay(day, suntimes.Tampere)[s.event]
+	if !happens {
+		return time.Time{}, false
+	}
+
+	return at.Add(s.offset), true
+}
+
+// returns nil spec if event is not a schedule (i.e. doesn't start with "cron:" or "sun:")
+func parseSchedule(event string) (scheduleSpec, error) {
+	switch {
+	case strings.HasPrefix(event, "cron:"):
+		cron, err := parseCronExpr(strings.TrimPrefix(event, "cron:"))
+		if err != nil {
+			return nil, err
+		}
+		return cron, nil
+	case strings.HasPrefix(event, "sun:"):
+		sun, err := parseSunSchedule(strings.TrimPrefix(event, "sun:"))
+		if err != nil {
+			return nil, err
+		}
+		return sun, nil
+	default:
+		return nil, nil
+	}
+}
+
+func parseSunSchedule(spec string) (*sunSchedule, error) {
+	sunEvent := spec
+	offset := time.Duration(0)
+
+	if offsetIdx := strings.IndexAny(spec, "+-"); offsetIdx != -1 {
+		sunEvent = spec[:offsetIdx]
+
+		var err error
+		offset, err = time.ParseDuration(spec[offsetIdx:])
+		if err != nil {
+			return nil, fmt.Errorf("sun %s: invalid offset: %v", spec, err)
+		}
+	}
+
+	if !suntimes.IsEventName(sunEvent) {
+		return nil, fmt.Errorf("sun %s: unknown event %s; supported: %s", spec, sunEvent, strings.Join(suntimes.EventNames, ", "))
+	}
+
+	return &sunSchedule{
+		event:  sunEvent,
+		offset: offset,
+	}, nil
+}
+
+type scheduledEvent struct {
+	event     string // topic to publish, also the schedule's definition
+	spec      scheduleSpec
+	next      time.Time
+	lastFired *time.Time
+}
+
+// for UI
+type scheduleStatus struct {
+	Event     string
+	Next      time.Time
+	LastFired *time.Time
+}
+
+// fires "cron:..." and "sun:..." events that subscriptions are interested in. last firing times
+// are persisted in the statefile, so a restart doesn't fire an event twice.
+type scheduler struct {
+	schedules []*scheduledEvent
+	mu        sync.Mutex
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		schedules: []*scheduledEvent{},
+	}
+}
+
+// no-op if event is already scheduled. lastFired is optional
+func (s *scheduler) Add(event string, spec scheduleSpec, lastFired *time.Time, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.schedules {
+		if existing.event == event {
+			return
+		}
+	}
+
+	sched := &scheduledEvent{
+		event:     event,
+		spec:      spec,
+		lastFired: lastFired,
+	}
+
+	// resume from where we left off, but don't fire events that are long overdue
+	if lastFired != nil {
+		sched.next = spec.Next(*lastFired)
+	}
+	if sched.next.IsZero() || now.Sub(sched.next) > scheduleCatchUpWindow {
+		sched.next = spec.Next(now)
+	}
+
+	s.schedules = append(s.schedules, sched)
+}
+
+// returns events that are due, and marks them fired
+func (s *scheduler) Due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []string{}
+
+	for _, sched := range s.schedules {
+		if sched.next.IsZero() || sched.next.After(now) {
+			continue
+		}
+
+		due = append(due, sched.event)
+
+		firedAt := sched.next
+		sched.lastFired = &firedAt
+		sched.next = sched.spec.Next(now)
+	}
+
+	return due
+}
+
+// for persisting. keyed by event
+func (s *scheduler) LastFired() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastFired := map[string]time.Time{}
+	for _, sched := range s.schedules {
+		if sched.lastFired != nil {
+			lastFired[sched.event] = *sched.lastFired
+		}
+	}
+
+	return lastFired
+}
+
+func (s *scheduler) Statuses() []scheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := []scheduleStatus{}
+	for _, sched := range s.schedules {
+		statuses = append(statuses, scheduleStatus{
+			Event:     sched.event,
+			Next:      sched.next,
+			LastFired: sched.lastFired,
+		})
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Next.Before(statuses[j].Next)
+	})
+
+	return statuses
+}
+
+// called from main loop's ticker. returns true if anything fired
+func (a *Application) evaluateSchedules() bool {
+	due := a.schedules.Due(a.clock.Now())
+
+	for _, event := range due {
+		a.logl.Info.Printf("schedule %s fired", event)
+
+		a.publish(event)
+	}
+
+	return len(due) > 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulesFireOnceAcrossRestarts(t *testing.T) {
+	statefile := hapitypes.NewStatefile()
+
+	// returns events that fired at each point in time
+	run := func(times ...time.Time) string {
+		app := newScheduleTestApp(t, times[0], statefile)
+		clock := app.clock.(*simulatedClock)
+
+		fired := []string{}
+		for _, at := range times {
+			clock.AdvanceTo(at)
+
+			fired = append(fired, strings.Join(app.schedules.Due(at), ", "))
+		}
+
+		statefile.SchedulesLastFired = app.schedules.LastFired()
+
+		return strings.Join(fired, " | ")
+	}
+
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2019, 11, 4, hour, minute, second, 0, time.UTC) // monday
+	}
+
+	assert.EqualString(t, run(at(6, 59, 0), at(7, 0, 0), at(7, 0, 5)), " | cron:0 7 * * 1-5 | ")
+
+	// restarted within the same minute: no double fire
+	assert.EqualString(t, run(at(7, 0, 30)), "")
+
+	// next day we were down at 07:00, but back up within the catch-up window
+	tuesday := func(hour, minute int) time.Time {
+		return time.Date(2019, 11, 5, hour, minute, 0, 0, time.UTC)
+	}
+	assert.EqualString(t, run(tuesday(7, 3), tuesday(7, 4)), "cron:0 7 * * 1-5 | ")
+
+	// down for the whole wednesday morning: overdue firing is skipped
+	wednesday := time.Date(2019, 11, 6, 9, 0, 0, 0, time.UTC)
+	assert.EqualString(t, run(wednesday), "")
+}
+
+func TestSunSchedule(t *testing.T) {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	assert.Assert(t, err == nil)
+
+	spec, err := parseSchedule("sun:sunset-30m")
+	assert.Assert(t, err == nil)
+
+	sunset := spec.(*sunSchedule)
+	assert.EqualString(t, sunset.event, "sunset")
+
+	next := spec.Next(time.Date(2019, 1, 14, 12, 0, 0, 0, helsinki))
+	assert.EqualString(t, next.Format("2006-01-02 15:04"), "2019-01-14 15:11")
+
+	// already passed today => tomorrow
+	next = spec.Next(time.Date(2019, 1, 14, 16, 0, 0, 0, helsinki))
+	assert.EqualString(t, next.Format("2006-01-02"), "2019-01-15")
+
+	_, err = parseSchedule("sun:sundown")
+	assert.Assert(t, strings.HasPrefix(err.Error(), "sun sundown: unknown event sundown"))
+
+	_, err = parseSchedule("sun:sunset+half")
+	assert.Assert(t, strings.HasPrefix(err.Error(), "sun sunset+half: invalid offset"))
+
+	notSchedule, err := parseSchedule("contact:frontDoor:false")
+	assert.Assert(t, notSchedule == nil && err == nil)
+}
+
+func newScheduleTestApp(t *testing.T, now time.Time, statefile hapitypes.Statefile) *Application {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(now))
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{Event: "cron:0 7 * * 1-5"},
+		},
+	}, statefile, logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	return app
+}
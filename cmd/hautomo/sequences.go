@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// what to do when a named sequence is triggered while a previous run is still going
+const (
+	sequenceModeParallel = "parallel" // default. start another run alongside
+	sequenceModeRestart  = "restart"  // cancel the previous run
+	sequenceModeIgnore   = "ignore"   // ignore-while-running
+	sequenceModeQueue    = "queue"    // start after the previous run(s) finish
+)
+
+func validateSequenceMode(subscription hapitypes.SubscribeConfig) error {
+	switch subscription.Mode {
+	case "", sequenceModeParallel:
+		return nil
+	case sequenceModeRestart, sequenceModeIgnore, sequenceModeQueue:
+		if subscription.Sequence == "" {
+			return fmt.Errorf("subscription %s: mode %s requires sequence name", subscription.Event, subscription.Mode)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("subscription %s: unknown sequence mode: %s", subscription.Event, subscription.Mode)
+	}
+}
+
+// one run of a subscription's actions
+type actionSequence struct {
+	name          string // empty if subscription didn't name its sequence
+	trigger       string // topic that started us
+	actions       []hapitypes.ActionConfig
+	started       time.Time
+	next          int        // index of next action to run
+	sleepingUntil *time.Time // if waiting on a sleep action
+	cancelled     bool
+}
+
+// for UI
+type actionSequenceStatus struct {
+	Name          string
+	Trigger       string
+	Started       time.Time
+	Step          int
+	Steps         int
+	SleepingUntil *time.Time
+}
+
+// tracks running sequences, so they can be restarted, cancelled and inspected. sequences run
+// partly from timers, so all state is guarded by the mutex.
+type sequenceRunner struct {
+	running []*actionSequence
+	queued  []*actionSequence
+	mu      sync.Mutex
+}
+
+func newSequenceRunner() *sequenceRunner {
+	return &sequenceRunner{
+		running: []*actionSequence{},
+		queued:  []*actionSequence{},
+	}
+}
+
+// returns sequence that should be started now (nil if ignored or queued)
+func (s *sequenceRunner) Start(seq *actionSequence, mode string) *actionSequence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq.name != "" && s.isRunning(seq.name) {
+		switch mode {
+		case sequenceModeRestart:
+			s.cancel(seq.name)
+		case sequenceModeIgnore:
+			return nil
+		case sequenceModeQueue:
+			s.queued = append(s.queued, seq)
+			return nil
+		}
+	}
+
+	s.running = append(s.running, seq)
+
+	return seq
+}
+
+// returns false if sequence was cancelled
+func (s *sequenceRunner) NextAction(seq *actionSequence) (hapitypes.ActionConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq.cancelled || seq.next >= len(seq.actions) {
+		return hapitypes.ActionConfig{}, false
+	}
+
+	action := seq.actions[seq.next]
+	seq.next++
+	seq.sleepingUntil = nil
+
+	return action, true
+}
+
+func (s *sequenceRunner) Sleeping(seq *actionSequence, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq.sleepingUntil = &until
+}
+
+// returns queued sequence (if any) that should be started now
+func (s *sequenceRunner) Finished(seq *actionSequence, now time.Time) *actionSequence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(seq)
+
+	if seq.name == "" || s.isRunning(seq.name) {
+		return nil
+	}
+
+	for i, queued := range s.queued {
+		if queued.name == seq.name {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			s.running = append(s.running, queued)
+			queued.started = now // visible to Statuses() from now on, so set under mu
+			return queued
+		}
+	}
+
+	return nil
+}
+
+// cancels running and queued runs of the named sequence. returns number of runs cancelled
+func (s *sequenceRunner) Cancel(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelled := s.cancel(name)
+
+	remainingQueued := []*actionSequence{}
+	for _, queued := range s.queued {
+		if queued.name == name {
+			cancelled++
+		} else {
+			remainingQueued = append(remainingQueued, queued)
+		}
+	}
+	s.queued = remainingQueued
+
+	return cancelled
+}
+
+func (s *sequenceRunner) Statuses() []actionSequenceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := []actionSequenceStatus{}
+	for _, seq := range s.running {
+		statuses = append(statuses, actionSequenceStatus{
+			Name:          seq.name,
+			Trigger:       seq.trigger,
+			Started:       seq.started,
+			Step:          seq.next,
+			Steps:         len(seq.actions),
+			SleepingUntil: seq.sleepingUntil,
+		})
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Started.Before(statuses[j].Started)
+	})
+
+	return statuses
+}
+
+// must be called with mu held
+func (s *sequenceRunner) cancel(name string) int {
+	cancelled := 0
+
+	remaining := []*actionSequence{}
+	for _, seq := range s.running {
+		if seq.name == name {
+			seq.cancelled = true // pending sleep timer will notice this
+			cancelled++
+		} else {
+			remaining = append(remaining, seq)
+		}
+	}
+	s.running = remaining
+
+	return cancelled
+}
+
+func (s *sequenceRunner) isRunning(name string) bool {
+	for _, seq := range s.running {
+		if seq.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *sequenceRunner) remove(seq *actionSequence) {
+	for i, running := range s.running {
+		if running == seq {
+			s.running = append(s.running[:i], s.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// "sleep" doesn't block, but schedules the rest of the actions to be ran later
+func (a *Application) runSequence(seq *actionSequence) {
+	for {
+		action, ok := a.sequences.NextAction(seq)
+		if !ok {
+			break
+		}
+
+		if action.Verb == "sleep" {
+			duration := time.Duration(action.DurationSeconds) * time.Second
+
+			a.sequences.Sleeping(seq, a.clock.Now().Add(duration))
+
+			a.clock.AfterFunc(duration, func() {
+				a.runSequence(seq)
+			})
+
+			return
+		}
+
+		if err := a.runAction(action, seq.trigger); err != nil {
+			a.logl.Error.Printf("failure running action: %v", err)
+		}
+	}
+
+	if next := a.sequences.Finished(seq, a.clock.Now()); next != nil {
+		a.spawn(func() {
+			a.runSequence(next)
+		})
+	}
+}
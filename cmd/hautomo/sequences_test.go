@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSequenceModes(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+
+	// presses at 0 s and 30 s. colors observed at 30 s, 65 s, 95 s and 130 s
+	for _, tc := range []struct {
+		mode     string
+		expected string
+	}{
+		// second press cancels the first run's pending blue
+		{sequenceModeRestart, "red; red |  | blue | "},
+		// second press is ignored
+		{sequenceModeIgnore, "red | blue |  | "},
+		// second run starts when first finishes
+		{sequenceModeQueue, "red | blue; red |  | blue"},
+		// both runs finish
+		{sequenceModeParallel, "red; red | blue | blue | "},
+	} {
+		tc := tc
+		t.Run(tc.mode, func(t *testing.T) {
+			clock := newSimulatedClock(t0)
+			app, press, colors := newSequenceTestApp(t, clock, tc.mode)
+
+			observed := []string{}
+
+			press("on")
+			clock.AdvanceTo(t0.Add(30 * time.Second))
+			press("on")
+
+			for _, at := range []time.Duration{65 * time.Second, 95 * time.Second, 130 * time.Second} {
+				observed = append(observed, colors())
+				clock.AdvanceTo(t0.Add(at))
+			}
+			observed = append(observed, colors())
+
+			assert.EqualString(t, strings.Join(observed, " | "), tc.expected)
+			assert.Assert(t, len(app.sequences.Statuses()) == 0)
+		})
+	}
+}
+
+func TestSequenceCancel(t *testing.T) {
+	t0 := time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)
+	clock := newSimulatedClock(t0)
+	app, press, colors := newSequenceTestApp(t, clock, sequenceModeRestart)
+
+	press("on")
+
+	statuses := app.sequences.Statuses()
+	assert.Assert(t, len(statuses) == 1)
+	assert.EqualString(t, statuses[0].Name, "fade")
+	assert.EqualString(t, fmt.Sprintf("%d/%d", statuses[0].Step, statuses[0].Steps), "2/3")
+	assert.EqualString(t, statuses[0].SleepingUntil.Format("15:04:05"), "03:01:00")
+
+	press("off")
+
+	clock.AdvanceTo(t0.Add(65 * time.Second))
+
+	assert.EqualString(t, colors(), "red")
+	assert.Assert(t, len(app.sequences.Statuses()) == 0)
+}
+
+func TestValidateSequenceMode(t *testing.T) {
+	assert.Assert(t, validateSequenceMode(hapitypes.SubscribeConfig{}) == nil)
+	assert.Assert(t, validateSequenceMode(hapitypes.SubscribeConfig{Sequence: "fade", Mode: "queue"}) == nil)
+	assert.EqualString(
+		t,
+		validateSequenceMode(hapitypes.SubscribeConfig{Event: "foo", Mode: "restart"}).Error(),
+		"subscription foo: mode restart requires sequence name")
+	assert.EqualString(
+		t,
+		validateSequenceMode(hapitypes.SubscribeConfig{Event: "foo", Sequence: "fade", Mode: "later"}).Error(),
+		"subscription foo: unknown sequence mode: later")
+}
+
+// "on" starts sequence "fade" (red, sleep 60 s, blue), "off" cancels it
+func newSequenceTestApp(
+	t *testing.T,
+	clock *simulatedClock,
+	mode string,
+) (*Application, func(string), func() string) {
+	app := newApplication(logex.Discard, nil, clock)
+	app.spawn = func(fn func()) { fn() }
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{Id: "zigbee", Type: "zigbee2mqtt"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "lamp", AdapterId: "zigbee", AdaptersDeviceId: "0x01", Type: "ikea-trådfri-rgb"},
+			{DeviceId: "remote", AdapterId: "zigbee", AdaptersDeviceId: "0x02", Type: "ikea-trådfri-remote"},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event:    "pushbutton:remote:on",
+				Sequence: "fade",
+				Mode:     mode,
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "color", Device: "lamp", Color: "red"},
+					{Verb: "sleep", DurationSeconds: 60},
+					{Verb: "color", Device: "lamp", Color: "blue"},
+				},
+			},
+			{
+				Event: "pushbutton:remote:off",
+				Actions: []hapitypes.ActionConfig{
+					{Verb: "cancel", Sequence: "fade"},
+				},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	zigbee := app.adapterById["zigbee"]
+
+	press := func(button string) {
+		app.handleIncomingEvent(hapitypes.NewPushButtonEvent("remote", button))
+	}
+
+	colorNames := map[string]string{"#ff0000": "red", "#0000ff": "blue"}
+
+	colors := func() string {
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+
+		msgs := []string{}
+		for len(zigbee.Outbound) > 0 {
+			if colorMsg, is := (<-zigbee.Outbound).(*hapitypes.ColorMsg); is {
+				msgs = append(msgs, colorNames[colorMsg.Color.Hex()])
+			}
+		}
+		return strings.Join(msgs, "; ")
+	}
+
+	return app, press, colors
+}
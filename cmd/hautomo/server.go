@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/function61/gokit/dynversion"
@@ -8,6 +9,7 @@ import (
 	"github.com/function61/gokit/logex"
 	"github.com/function61/gokit/stopper"
 	"github.com/function61/hautomo/pkg/constmetrics"
+	"github.com/function61/hautomo/pkg/eventjournal"
 	"github.com/function61/hautomo/pkg/hapitypes"
 	"github.com/function61/hautomo/pkg/suntimes"
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,36 +17,60 @@ import (
 	"time"
 )
 
-const statefilePath = "state-snapshot.json"
+const (
+	statefilePath          = "state-snapshot.json"
+	eventJournalPath       = "events.log"
+	dryRunEventJournalPath = "events.dry-run.log" // so we don't append to production's journal
+)
+
+const actionResultTimeout = 30 * time.Second
 
 type Application struct {
 	adapterById   map[string]*hapitypes.Adapter
 	deviceById    map[string]*hapitypes.Device
-	subscriptions map[string]*hapitypes.SubscribeConfig
+	subscriptions []*hapitypes.SubscribeConfig
 	powerManager  *PowerManager
 	inbound       *hapitypes.InboundFabric
 	booleans      *booleanStorage
+	variables     *variableStorage
 	constMetrics  *constmetrics.Collector
 	logl          *logex.Leveled
 	policyEngine  *policyEngine
+	journal       *eventjournal.Journal // nil when replaying
+	clock         clock
+	spawn         func(fn func()) // how to run subscription actions "in the background"
+	dryRun        bool            // outbound messages are only logged and counted
+	dryRunCounter *prometheus.CounterVec
+	rejections    *inboundRejections
+	// for explicit power events whose originator wants a result. keyed by device id
+	powerCorrelations map[string]string
+	scenes            *sceneStorage
+	sequences         *sequenceRunner
+	heldStates        []*heldStateTrigger
+	schedules         *scheduler
+	persons           *personRegistry
+	areas             *areaRegistry
+	// devices whose pending power change was explicitly asked, so device groups can pass it on
+	explicitPower map[string]bool
 }
 
-func NewApplication(logger *log.Logger, stop *stopper.Stopper) *Application {
-	app := &Application{
-		adapterById:   map[string]*hapitypes.Adapter{},
-		deviceById:    map[string]*hapitypes.Device{},
-		subscriptions: map[string]*hapitypes.SubscribeConfig{},
-		powerManager:  NewPowerManager(),
-		inbound:       hapitypes.NewInboundFabric(),
-		booleans:      NewBooleanStorage("anybodyHome", "environmentHasLight"),
-		constMetrics:  constmetrics.NewCollector(),
-		logl:          logex.Levels(logger),
-	}
+func NewApplication(logger *log.Logger, journal *eventjournal.Journal, dryRun bool, stop *stopper.Stopper) *Application {
+	app := newApplication(logger, journal, realClock{})
 
-	prometheus.MustRegister(app.constMetrics)
+	prometheus.MustRegister(app.rejections.metric)
+	prometheus.MustRegister(app.powerManager.suppressedMetric)
 
-	app.booleans.Set("anybodyHome", true)
-	app.updateEnvironmentLightStatus(false)
+	if dryRun {
+		app.dryRun = true
+		app.dryRunCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hautomo_dryrun_suppressed_outbound_total",
+			Help: "Outbound messages not sent to adapters due to dry-run mode",
+		}, []string{"adapter", "type"})
+
+		prometheus.MustRegister(app.dryRunCounter)
+
+		app.logl.Info.Println("dry-run mode: outbound messages will not be sent to adapters")
+	}
 
 	everyMinute := time.NewTicker(1 * time.Minute)
 	every5s := time.NewTicker(5 * time.Second)
@@ -65,6 +91,16 @@ func NewApplication(logger *log.Logger, stop *stopper.Stopper) *Application {
 			case <-every5s.C:
 				// TODO: generate a tick inbound event, and thus we'd be able to use
 				//       handleIncomingEvent() for this?
+				app.evaluateHeldStates()
+				app.evaluatePresence()
+
+				// persist immediately, so a crash can't make a schedule fire twice
+				if app.evaluateSchedules() {
+					if err := app.saveStateSnapshot(); err != nil {
+						app.logl.Error.Printf("failed saving state: %v", err)
+					}
+				}
+
 				app.applyPowerDiffs()
 			case <-everyMinute.C:
 				app.updateEnvironmentLightStatus(true)
@@ -83,38 +119,169 @@ func NewApplication(logger *log.Logger, stop *stopper.Stopper) *Application {
 	return app
 }
 
+// main loop is not started, so caller can drive the application (used by replay)
+func newApplication(logger *log.Logger, journal *eventjournal.Journal, clock clock) *Application {
+	app := &Application{
+		adapterById:   map[string]*hapitypes.Adapter{},
+		deviceById:    map[string]*hapitypes.Device{},
+		subscriptions: []*hapitypes.SubscribeConfig{},
+		powerManager:  NewPowerManager(clock),
+		inbound:       hapitypes.NewInboundFabric(logex.Levels(logex.Prefix("inbound", logger))),
+		booleans:      NewBooleanStorage(clock, "anybodyHome", "environmentHasLight"),
+		variables:     newVariableStorage(clock),
+		constMetrics:  constmetrics.NewCollector(),
+		logl:          logex.Levels(logger),
+		journal:       journal,
+		clock:         clock,
+		spawn: func(fn func()) {
+			go fn()
+		},
+		rejections:        newInboundRejections(),
+		powerCorrelations: map[string]string{},
+		explicitPower:     map[string]bool{},
+		scenes:            newSceneStorage(),
+		sequences:         newSequenceRunner(),
+		schedules:         newScheduler(),
+		persons:           newPersonRegistry(),
+		areas:             &areaRegistry{devices: map[string][]string{}},
+	}
+
+	app.inbound.Now = clock.Now
+
+	if journal != nil { // avoid storing typed nil in the interface
+		app.inbound.Observer = journal
+	}
+
+	prometheus.MustRegister(app.constMetrics)
+	prometheus.MustRegister(app.inbound.Metrics)
+	prometheus.MustRegister(app.booleans)
+
+	app.booleans.Set("anybodyHome", true)
+	app.updateEnvironmentLightStatus(false)
+
+	return app
+}
+
 func (a *Application) applyPowerDiffs() {
 	a.policyEngine.evaluatePowerPolicies(a.powerManager)
 
-	for _, diff := range a.powerManager.Diff() {
+	diffs := a.powerManager.Diff()
+
+	for _, suppression := range a.powerManager.NewSuppressions() {
+		a.logl.Info.Printf(
+			"%s => on=%v suppressed (%s)",
+			suppression.Device,
+			suppression.On,
+			suppression.Reason)
+	}
+
+	for _, diff := range diffs {
 		device := a.deviceById[diff.Device]
 
-		var msg *hapitypes.PowerMsg
 		if diff.On {
 			a.publish(fmt.Sprintf("device:%s:power:on", device.Conf.DeviceId))
-			msg = hapitypes.NewPowerMsg(
-				device.Conf.AdaptersDeviceId,
-				device.Conf.PowerOnCmd,
-				true)
 		} else {
 			a.publish(fmt.Sprintf("device:%s:power:off", device.Conf.DeviceId))
-			msg = hapitypes.NewPowerMsg(
-				device.Conf.AdaptersDeviceId,
-				device.Conf.PowerOffCmd,
-				false)
 		}
 
 		device.ProbablyTurnedOn = diff.On
 
-		adapter := a.adapterById[device.Conf.AdapterId]
-		adapter.Send(msg)
+		correlationId := a.powerCorrelations[diff.Device]
+		delete(a.powerCorrelations, diff.Device)
+
+		explicit := a.explicitPower[diff.Device]
+		delete(a.explicitPower, diff.Device)
+
+		a.sendPower(device, diff.On, correlationId, explicit)
 
 		a.powerManager.ApplyDiff(diff)
 	}
+
+	// group is on if any of its members is
+	for _, device := range a.deviceById {
+		if isDeviceGroup(device) {
+			device.ProbablyTurnedOn = a.powerManager.GetActual(device.Conf.DeviceId)
+		}
+	}
+
+	retries, gaveUp := a.powerManager.Retries(a.clock.Now())
+
+	for _, retry := range retries {
+		a.logl.Info.Printf("%s did not confirm power on=%v; retrying", retry.Device, retry.On)
+
+		a.sendPower(a.deviceById[retry.Device], retry.On, "", false)
+	}
+
+	for _, deviceId := range gaveUp {
+		a.logl.Error.Printf("%s did not confirm power; giving up", deviceId)
+
+		a.publish(fmt.Sprintf("device:%s:power-unconfirmed", deviceId))
+	}
+
+	// device already was in the requested state => nothing to send
+	for deviceId, correlationId := range a.powerCorrelations {
+		if !a.powerManager.IsSettled(deviceId) { // reported when the change gets applied
+			continue
+		}
+
+		a.inbound.Results.Report(hapitypes.CommandResult{
+			CorrelationId: correlationId,
+			Device:        deviceId,
+			Type:          "PowerMsg",
+		})
+
+		delete(a.powerCorrelations, deviceId)
+	}
+}
+
+func (a *Application) sendPower(device *hapitypes.Device, on bool, correlationId string, explicit bool) {
+	cmd := device.Conf.PowerOffCmd
+	if on {
+		cmd = device.Conf.PowerOnCmd
+	}
+
+	msg := hapitypes.NewPowerMsg(
+		device.Conf.AdaptersDeviceId,
+		cmd,
+		on)
+	msg.Explicit = explicit
+
+	adapter := a.adapterById[device.Conf.AdapterId]
+	a.send(adapter, device, correlationId, msg)
+}
+
+// device is the hub's device the event is about. correlationId is optional.
+func (a *Application) send(adapter *hapitypes.Adapter, device *hapitypes.Device, correlationId string, e hapitypes.OutboundEvent) {
+	e.OutMeta().CorrelationId = correlationId
+	e.OutMeta().Device = device.Conf.DeviceId
+
+	// each member reports its own result
+	if adapter.Conf.Type == "devicegroup" && correlationId != "" {
+		a.inbound.Results.FanOut(correlationId, len(adapter.Conf.DevicegroupDevices))
+	}
+
+	// device groups only redirect to member devices (whose outbound we'll intercept here)
+	if a.dryRun && adapter.Conf.Type != "devicegroup" {
+		eventJson, _ := json.Marshal(e)
+
+		a.logl.Info.Printf(
+			"dry-run: suppressed %s to %s: %s",
+			e.OutboundEventType(),
+			adapter.Conf.Id,
+			eventJson)
+
+		a.dryRunCounter.WithLabelValues(adapter.Conf.Id, e.OutboundEventType()).Inc()
+
+		// pretend success, so originators don't wait for a result that never comes
+		adapter.Report(e, nil)
+		return
+	}
+
+	adapter.Send(e)
 }
 
 func (a *Application) updateEnvironmentLightStatus(broadcastChanges bool) {
-	hasLight := suntimes.IsBetweenGoldenHours(time.Now(), suntimes.Tampere)
+	hasLight := suntimes.IsBetweenGoldenHours(a.clock.Now(), suntimes.Tampere)
 	changed, _ := a.booleans.Set("environmentHasLight", hasLight)
 	if changed && broadcastChanges {
 		a.logl.Info.Printf("environmentHasLight changed to %v", hasLight)
@@ -122,12 +289,26 @@ func (a *Application) updateEnvironmentLightStatus(broadcastChanges bool) {
 }
 
 func (a *Application) saveStateSnapshot() error {
+	// statefile belongs to the production instance. we only read it on startup
+	if a.dryRun {
+		return nil
+	}
+
+	statefile, err := a.snapshotState()
+	if err != nil {
+		return err
+	}
+
+	return jsonfile.Write(statefilePath, &statefile)
+}
+
+func (a *Application) snapshotState() (hapitypes.Statefile, error) {
 	statefile := hapitypes.NewStatefile()
 
 	for _, device := range a.deviceById {
 		snap, err := device.SnapshotState()
 		if err != nil {
-			return err
+			return statefile, err
 		}
 
 		snap.ProbablyTurnedOn = a.powerManager.GetActual(device.Conf.DeviceId)
@@ -135,19 +316,72 @@ func (a *Application) saveStateSnapshot() error {
 		statefile.Devices[device.Conf.DeviceId] = *snap
 	}
 
-	return jsonfile.Write(statefilePath, &statefile)
+	statefile.Scenes = a.scenes.Captured()
+	statefile.SchedulesLastFired = a.schedules.LastFired()
+	statefile.Booleans = a.booleans.Snapshot()
+	statefile.Variables = a.variables.Snapshot()
+	statefile.Persons = a.persons.Snapshot()
+
+	for _, held := range a.heldStates {
+		if !held.firedFor.IsZero() {
+			statefile.HeldStatesFiredFor[held.conf.Id] = held.firedFor
+		}
+	}
+
+	return statefile, nil
 }
 
 func (a *Application) handleIncomingEvent(inboundEvent hapitypes.InboundEvent) {
-	// TODO: maybe record this in the inbound event, so we can get more accurate time
-	now := time.Now()
+	// origin timestamp, so events that sat in the queue are recorded with accurate time
+	now := inboundEvent.Meta().When
+	if now.IsZero() { // didn't go through InboundFabric
+		now = a.clock.Now()
+	}
+
+	correlationId := inboundEvent.Meta().CorrelationId
+
+	if reason, message := a.validateInboundEvent(inboundEvent); reason != "" {
+		a.logl.Error.Printf("rejected %s: %s", inboundEvent.InboundEventType(), message)
+
+		a.inbound.Results.Report(hapitypes.CommandResult{
+			CorrelationId: correlationId,
+			Type:          inboundEvent.InboundEventType(),
+			Error:         "rejected: " + message,
+		})
+
+		a.rejections.record(inboundRejection{
+			When:    now,
+			Source:  inboundEvent.Meta().Source,
+			Type:    inboundEvent.InboundEventType(),
+			Reason:  reason,
+			Message: message,
+		})
+		return
+	}
+
+	if areaId, capability := inboundEventTarget(inboundEvent); a.areas.Has(areaId) {
+		a.sendToArea(areaId, capability, inboundEvent)
+		return
+	}
 
 	switch e := inboundEvent.(type) {
 	case *hapitypes.PersonPresenceChangeEvent:
-		a.logl.Info.Printf(
-			"Person %s presence changed to %v",
-			e.PersonId,
-			e.Present)
+		source := inboundEvent.Meta().Source
+		if e.Via != "" {
+			source += "/" + e.Via
+		}
+
+		a.logl.Debug.Printf("%s reports %s present=%v", source, e.PersonId, e.Present)
+
+		changed, err := a.persons.Report(e.PersonId, source, e.Present, now)
+		if err != nil {
+			a.logl.Error.Printf("presence: %v", err)
+			return
+		}
+
+		if changed {
+			a.personPresenceChanged(e.PersonId, e.Present)
+		}
 	case *hapitypes.PowerEvent:
 		device := a.deviceById[e.DeviceIdOrDeviceGroupId]
 
@@ -162,12 +396,33 @@ func (a *Application) handleIncomingEvent(inboundEvent hapitypes.InboundEvent) {
 			a.powerManager.Set(device.Conf.DeviceId, e.Kind)
 		}
 
+		// groups are always forced, but only explicit ones may bypass members' limits
+		if e.Explicit {
+			a.explicitPower[device.Conf.DeviceId] = true
+		} else {
+			delete(a.explicitPower, device.Conf.DeviceId)
+		}
+
+		if correlationId != "" { // result gets reported when the power diff is applied
+			a.powerCorrelations[device.Conf.DeviceId] = correlationId
+		}
+
 		// no need to call applyPowerDiffs(), as it will get called automatically after handleIncomingEvent()
+	case *hapitypes.PowerReportEvent:
+		device := a.updateLastOnline(e.Device, now)
+
+		if a.powerManager.Report(e.Device, e.On) {
+			a.logl.Info.Printf("%s power changed externally to on=%v", e.Device, e.On)
+
+			device.ProbablyTurnedOn = e.On
+		}
 	case *hapitypes.ColorTemperatureEvent:
 		device := a.deviceById[e.Device]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewColorTemperatureEvent(
+		device.LastColorTemperature = e.TemperatureInKelvin
+
+		a.send(adapter, device, correlationId, hapitypes.NewColorTemperatureEvent(
 			device.Conf.AdaptersDeviceId,
 			e.TemperatureInKelvin))
 	case *hapitypes.ColorMsg:
@@ -175,17 +430,32 @@ func (a *Application) handleIncomingEvent(inboundEvent hapitypes.InboundEvent) {
 		adapter := a.adapterById[device.Conf.AdapterId]
 
 		device.LastColor = e.Color
+		device.LastColorTemperature = 0
 
-		adapter.Send(hapitypes.NewColorMsg(
+		a.send(adapter, device, correlationId, hapitypes.NewColorMsg(
 			device.Conf.AdaptersDeviceId,
 			e.Color))
 	case *hapitypes.PublishEvent:
 		a.publish(e.Topic)
+	case *hapitypes.SceneActivationEvent:
+		if err := a.activateScene(e); err != nil {
+			a.logl.Error.Printf("activateScene: %v", err)
+			a.reportHubResult(inboundEvent, err)
+		}
+	case *hapitypes.SceneCaptureEvent:
+		err := a.captureScene(e)
+		if err != nil {
+			a.logl.Error.Printf("captureScene: %v", err)
+		}
+
+		a.reportHubResult(inboundEvent, err)
 	case *hapitypes.BrightnessEvent:
 		device := a.deviceById[e.DeviceIdOrDeviceGroupId]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewBrightnessMsg(
+		device.LastBrightness = e.Brightness
+
+		a.send(adapter, device, correlationId, hapitypes.NewBrightnessMsg(
 			device.Conf.AdaptersDeviceId,
 			e.Brightness,
 			device.LastColor))
@@ -193,54 +463,67 @@ func (a *Application) handleIncomingEvent(inboundEvent hapitypes.InboundEvent) {
 		device := a.deviceById[e.Device]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewPlaybackEvent(
+		a.send(adapter, device, correlationId, hapitypes.NewPlaybackEvent(
 			device.Conf.AdaptersDeviceId,
 			e.Action))
 	case *hapitypes.BlinkEvent:
 		device := a.deviceById[e.DeviceId]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewBlinkEvent(device.Conf.AdaptersDeviceId))
+		a.send(adapter, device, correlationId, hapitypes.NewBlinkEvent(device.Conf.AdaptersDeviceId))
 	case *hapitypes.NotificationEvent:
 		device := a.deviceById[e.Device]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewNotificationEvent(device.Conf.AdaptersDeviceId, e.Message))
+		message := e.Message
+		if e.TemplateTrigger != "" {
+			message = a.renderNotifyTemplate(e.Message, e.TemplateTrigger)
+		}
+
+		a.send(adapter, device, correlationId, hapitypes.NewNotificationEvent(device.Conf.AdaptersDeviceId, message))
 	case *hapitypes.InfraredEvent:
 		device := a.deviceById[e.Device]
 		adapter := a.adapterById[device.Conf.AdapterId]
 
-		adapter.Send(hapitypes.NewInfraredEvent(device.Conf.AdaptersDeviceId, e.Command))
+		a.send(adapter, device, correlationId, hapitypes.NewInfraredEvent(device.Conf.AdaptersDeviceId, e.Command))
 	case *hapitypes.RawInfraredEvent:
 		a.publish(fmt.Sprintf("infrared:%s:%s", e.Remote, e.Event))
 	case *hapitypes.MotionEvent:
-		dev := a.updateLastOnline(e.Device)
+		dev := a.updateLastOnline(e.Device, now)
 		if e.Movement {
 			dev.LastMotion = &now
 		}
 		a.publish(fmt.Sprintf("motion:%s:%v", e.Device, e.Movement))
 	case *hapitypes.ContactEvent:
-		dev := a.updateLastOnline(e.Device)
+		dev := a.updateLastOnline(e.Device, now)
+		if dev.LastContact == nil || dev.LastContact.Contact != e.Contact {
+			dev.ContactSince = &now
+		}
 		dev.LastContact = e
 		a.publish(fmt.Sprintf("contact:%s:%v", e.Device, e.Contact))
 	case *hapitypes.VibrationEvent:
-		a.updateLastOnline(e.Device)
+		a.updateLastOnline(e.Device, now)
 		a.publish(fmt.Sprintf("vibration:%s", e.Device))
 	case *hapitypes.PushButtonEvent:
-		a.updateLastOnline(e.Device)
+		a.updateLastOnline(e.Device, now)
 		a.publish(fmt.Sprintf("pushbutton:%s:%s", e.Device, e.Specifier))
 	case *hapitypes.WaterLeakEvent:
-		a.updateLastOnline(e.Device)
+		dev := a.updateLastOnline(e.Device, now)
+		if !e.WaterDetected {
+			dev.WaterLeakSince = nil
+		} else if dev.WaterLeakSince == nil {
+			dev.WaterLeakSince = &now
+		}
 		a.publish(fmt.Sprintf("waterleak:%s:%v", e.Device, e.WaterDetected))
 	case *hapitypes.LinkQualityEvent:
-		a.updateLastOnline(e.Device)
+		a.updateLastOnline(e.Device, now)
 
 		device := a.deviceById[e.Device]
 		device.LinkQuality = e.LinkQuality
 
 		a.constMetrics.Observe(device.LinkQualityMetric, float64(e.LinkQuality), now)
 	case *hapitypes.BatteryStatusEvent:
-		a.updateLastOnline(e.Device)
+		a.updateLastOnline(e.Device, now)
 
 		device := a.deviceById[e.Device]
 		device.BatteryPct = e.BatteryPct
@@ -263,88 +546,96 @@ func (a *Application) handleIncomingEvent(inboundEvent hapitypes.InboundEvent) {
 			a.constMetrics.Observe(device.PressureMetric, e.Pressure, now)
 		}
 
-		a.updateLastOnline(e.Device)
+		a.updateLastOnline(e.Device, now)
 	default:
 		a.logl.Error.Printf("Unsupported inbound event: " + inboundEvent.InboundEventType())
 	}
 }
 
-func (a *Application) updateLastOnline(deviceId string) *hapitypes.Device {
+// for commands the hub executes itself (as opposed to sending to an adapter)
+func (a *Application) reportHubResult(e hapitypes.InboundEvent, err error) {
+	result := hapitypes.CommandResult{
+		CorrelationId: e.Meta().CorrelationId,
+		Adapter:       hapitypes.InboundSourceHub,
+		Type:          e.InboundEventType(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	a.inbound.Results.Report(result)
+}
+
+func (a *Application) updateLastOnline(deviceId string, now time.Time) *hapitypes.Device {
 	device := a.deviceById[deviceId]
-	now := time.Now()
 	device.LastOnline = &now
 	return device
 }
 
+// must be called from the main loop, because subscription conditions read device state
 func (a *Application) publish(event string) {
-	subscription, found := a.subscriptions[event]
-	if !found {
-		a.logl.Debug.Printf("event %s ignored", event)
-		return
-	} else {
-		a.logl.Debug.Printf("event %s", event)
+	if a.journal != nil {
+		a.journal.ObservePublish(event)
 	}
 
-	for _, condition := range subscription.Conditions {
-		switch condition.Type {
-		case "boolean-not-changed-within":
-			lastChange, err := a.booleans.GetLastChangeTime(condition.Boolean)
-			if err != nil {
-				a.logl.Error.Printf("error evaluating condition: %v", err)
-				return
-			}
+	matched := false
 
-			if time.Since(lastChange).Seconds() < float64(condition.DurationSeconds) {
-				a.logl.Debug.Printf(
-					"boolean %s changed within %d seconds - bailing out",
-					condition.Boolean,
-					condition.DurationSeconds)
-				return
-			}
-		case "boolean-is-false":
-			fallthrough
-		case "boolean-is-true":
-			val, err := a.booleans.Get(condition.Boolean)
-			if err != nil {
-				a.logl.Error.Printf("error evaluating condition: %v", err)
-				return
-			}
+	for _, subscription := range a.subscriptions {
+		if !topicMatches(subscription.Event, event) {
+			continue
+		}
 
-			expectedValue := condition.Type == "boolean-is-true"
+		matched = true
 
-			if val != expectedValue {
-				a.logl.Debug.Printf(
-					"bool %s expected %v but got %v - bailing out",
-					condition.Boolean,
-					expectedValue,
-					val)
-				return
-			}
+		a.logl.Debug.Printf("event %s matched %s", event, subscription.Event)
+
+		if !a.conditionsPass(subscription.Conditions) {
+			continue
 		}
-	}
 
-	// run async, so sleep actions don't disturb handling of actions before/after sleeping
-	go func() {
-		for _, action := range subscription.Actions {
-			if err := a.runAction(action); err != nil {
-				a.logl.Error.Printf("failure running action: %v", err)
-			}
+		seq := a.sequences.Start(&actionSequence{
+			name:    subscription.Sequence,
+			trigger: event,
+			actions: subscription.Actions,
+			started: a.clock.Now(),
+		}, subscription.Mode)
+		if seq == nil {
+			a.logl.Debug.Printf("sequence %s already running (mode %s)", subscription.Sequence, subscription.Mode)
+			continue
 		}
-	}()
+
+		// run async, so actions can't block handling of the event that triggered them
+		a.spawn(func() {
+			a.runSequence(seq)
+		})
+	}
+
+	if !matched {
+		a.logl.Debug.Printf("event %s ignored", event)
+	}
+}
+
+// actions run in sequence goroutines, so they publish via the main loop
+func (a *Application) publishFromSequence(event string) {
+	a.inbound.Receive(hapitypes.NewPublishEvent(event))
 }
 
-func (a *Application) runAction(action hapitypes.ActionConfig) error {
+// trigger is the topic that started the action's sequence
+func (a *Application) runAction(action hapitypes.ActionConfig, trigger string) error {
+	if action.Area != "" {
+		return a.runAreaAction(action, trigger)
+	}
+
 	switch action.Verb {
-	case "sleep":
-		time.Sleep(time.Duration(action.DurationSeconds) * time.Second)
 	case "powerOn":
-		a.inbound.Receive(hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindOn, false))
+		a.dispatchAction(action, hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindOn, false))
 	case "powerOff":
-		a.inbound.Receive(hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindOff, false))
+		a.dispatchAction(action, hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindOff, false))
 	case "powerToggle":
-		a.inbound.Receive(hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindToggle, false))
+		a.dispatchAction(action, hapitypes.NewPowerEvent(action.Device, hapitypes.PowerKindToggle, false))
 	case "blink":
-		a.inbound.Receive(hapitypes.NewBlinkEvent(action.Device))
+		a.dispatchAction(action, hapitypes.NewBlinkEvent(action.Device))
 	case "setBooleanTrue":
 		fallthrough
 	case "setBooleanFalse":
@@ -355,24 +646,44 @@ func (a *Application) runAction(action hapitypes.ActionConfig) error {
 		}
 
 		if changed {
-			if value {
-				a.publish(fmt.Sprintf("boolean:%s:changes-to-true", action.Boolean))
-			} else {
-				a.publish(fmt.Sprintf("boolean:%s:changes-to-false", action.Boolean))
-			}
+			a.publishFromSequence(booleanChangeTopic(action.Boolean, value))
 		}
 	case "ir":
-		a.inbound.Receive(hapitypes.NewInfraredEvent(
+		a.dispatchAction(action, hapitypes.NewInfraredEvent(
 			action.Device,
 			action.IrCommand))
 	case "playback":
-		a.inbound.Receive(hapitypes.NewPlaybackEvent(
+		a.dispatchAction(action, hapitypes.NewPlaybackEvent(
 			action.Device,
 			action.PlaybackAction))
 	case "notify":
-		a.inbound.Receive(hapitypes.NewNotificationEvent(
+		// rendered by handleIncomingEvent(), since we're not running on the main loop
+		a.dispatchAction(action, hapitypes.NewNotificationTemplateEvent(
 			action.Device,
-			action.NotifyMessage))
+			action.NotifyMessage,
+			trigger))
+	case "scene":
+		a.dispatchAction(action, hapitypes.NewSceneActivationEvent(action.Scene))
+	case "setVariable", "incrementVariable", "decrementVariable", "cycleVariable":
+		return a.runVariableAction(action)
+	case "cancel":
+		cancelled := a.sequences.Cancel(action.Sequence)
+		a.logl.Debug.Printf("cancelled %d run(s) of sequence %s", cancelled, action.Sequence)
+	case "brightness":
+		if action.Brightness > 100 {
+			return fmt.Errorf("brightness over 100 %%: %d", action.Brightness)
+		}
+
+		a.dispatchAction(action, hapitypes.NewBrightnessEvent(action.Device, action.Brightness))
+	case "color":
+		color, err := hapitypes.ParseColor(action.Color)
+		if err != nil {
+			return err
+		}
+
+		a.dispatchAction(action, hapitypes.NewColorMsg(action.Device, color))
+	case "colorTemperature":
+		a.dispatchAction(action, hapitypes.NewColorTemperatureEvent(action.Device, action.ColorTemperature))
 	default:
 		return fmt.Errorf("unknown verb: %s", action.Verb)
 	}
@@ -380,12 +691,104 @@ func (a *Application) runAction(action hapitypes.ActionConfig) error {
 	return nil
 }
 
+// catches config mistakes on startup instead of when the action first runs
+func validateLightAction(action hapitypes.ActionConfig) error {
+	target := action.Device
+	if action.Area != "" {
+		target = action.Area
+	}
+
+	switch action.Verb {
+	case "brightness":
+		if action.Brightness > 100 {
+			return fmt.Errorf("%s %s: brightness over 100 %%: %d", action.Verb, target, action.Brightness)
+		}
+	case "color":
+		if _, err := hapitypes.ParseColor(action.Color); err != nil {
+			return fmt.Errorf("%s %s: %v", action.Verb, target, err)
+		}
+	case "colorTemperature":
+		if action.ColorTemperature == 0 {
+			return fmt.Errorf("%s %s: color temperature not specified", action.Verb, target)
+		}
+	}
+
+	return nil
+}
+
+func isLightVerb(verb string) bool {
+	switch verb {
+	case "brightness", "color", "colorTemperature":
+		return true
+	default:
+		return false
+	}
+}
+
+// action sequences run in the background, so the best we can do with the result is to log failures
+func (a *Application) dispatchAction(action hapitypes.ActionConfig, e hapitypes.InboundEvent) {
+	correlationId := hapitypes.NewCorrelationId()
+	e.Meta().CorrelationId = correlationId
+
+	a.inbound.Results.Observe(correlationId, actionResultTimeout, func(result *hapitypes.CommandResult) {
+		if result != nil && !result.Succeeded() {
+			a.logl.Error.Printf("action %s %s failed: %s", action.Verb, action.Device, result.Error)
+		}
+	})
+
+	a.inbound.Receive(e)
+}
+
 func configureAppAndStartAdapters(
 	app *Application,
 	conf *hapitypes.ConfigFile,
+	statefile hapitypes.Statefile,
 	logger *log.Logger,
 	stopManager *stopper.Manager,
 ) error {
+	return configureApp(app, conf, statefile, logger, func(adapter *hapitypes.Adapter) error {
+		// SQS messages are consumed by whoever receives them first, so we'd steal Alexa's
+		// commands from the production instance
+		if app.dryRun && adapter.Conf.Type == "sqs" {
+			app.logl.Info.Printf("dry-run: not starting adapter %s", adapter.Conf.Id)
+			return nil
+		}
+
+		initFn, ok := adapters[adapter.Conf.Type]
+		if !ok {
+			return errors.New("unkown adapter: " + adapter.Conf.Type)
+		}
+
+		return initFn(adapter, stopManager.Stopper())
+	})
+}
+
+// startAdapter is called for each adapter, after which the adapter is registered to the app
+func configureApp(
+	app *Application,
+	conf *hapitypes.ConfigFile,
+	statefile hapitypes.Statefile,
+	logger *log.Logger,
+	startAdapter func(adapter *hapitypes.Adapter) error,
+) error {
+	areas, err := newAreaRegistry(conf)
+	if err != nil {
+		return err
+	}
+	app.areas = areas
+
+	groupCapabilities := map[string]hapitypes.Capabilities{}
+
+	for _, devGroup := range conf.DeviceGroups {
+		// also validates members and detects cycles (groups can contain groups)
+		caps, err := hapitypes.ResolveCapabilities(devGroup.DeviceId, conf)
+		if err != nil {
+			return fmt.Errorf("device group %s: %v", devGroup.DeviceId, err)
+		}
+
+		groupCapabilities[devGroup.DeviceId] = caps
+	}
+
 	for _, devGroup := range conf.DeviceGroups {
 		generatedAdapterId := devGroup.DeviceId + "Group"
 
@@ -395,48 +798,42 @@ func configureAppAndStartAdapters(
 			DevicegroupDevices: devGroup.Devices,
 		}
 
-		firstDeviceOfGroup := findDeviceConfig(devGroup.Devices[0], conf)
-		if firstDeviceOfGroup == nil {
-			return fmt.Errorf("device group device not found: %s", devGroup.Devices[0])
-		}
-
 		deviceConf := hapitypes.DeviceConfig{
 			DeviceId:      devGroup.DeviceId,
 			AdapterId:     adapterConf.Id,
 			Name:          devGroup.Name,
-			Description:   deviceGroupDescription,
-			AlexaCategory: firstDeviceOfGroup.AlexaCategory,
-			Type:          firstDeviceOfGroup.Type, // TODO: compute lowest common denominator type?
+			Description:   "Device group",
+			AlexaCategory: hapitypes.ResolveGroupAlexaCategory(devGroup, conf),
+			Type:          hapitypes.DeviceGroupType,
 		}
 
 		conf.Adapters = append(conf.Adapters, adapterConf)
 		conf.Devices = append(conf.Devices, deviceConf)
 	}
 
-	for _, adapterConf := range conf.Adapters {
-		initFn, ok := adapters[adapterConf.Type]
-		if !ok {
-			return errors.New("unkown adapter: " + adapterConf.Type)
-		}
+	var observer hapitypes.EventObserver
+	if app.journal != nil { // avoid storing typed nil in the interface
+		observer = app.journal
+	}
 
-		adapter := hapitypes.NewAdapter(
+	for _, adapterConf := range conf.Adapters {
+		adapter, err := hapitypes.NewAdapter(
 			adapterConf,
 			conf,
 			app.inbound,
+			observer,
 			logex.Prefix(adapterConf.Id, logger))
+		if err != nil {
+			return err
+		}
 
-		if err := initFn(adapter, stopManager.Stopper()); err != nil {
+		if err := startAdapter(adapter); err != nil {
 			return err
 		}
 
 		app.adapterById[adapter.Conf.Id] = adapter
 	}
 
-	statefile := hapitypes.NewStatefile()
-	if err := jsonfile.Read(statefilePath, &statefile, true); err != nil {
-		return err
-	}
-
 	for _, deviceConf := range conf.Devices {
 		if _, exists := app.deviceById[deviceConf.DeviceId]; exists {
 			return fmt.Errorf("duplicate device id %s", deviceConf.DeviceId)
@@ -455,8 +852,25 @@ func configureAppAndStartAdapters(
 			return err
 		}
 
+		if devGroup := conf.FindDeviceGroup(deviceConf.DeviceId); devGroup != nil {
+			device.DeviceType.Capabilities = groupCapabilities[devGroup.DeviceId]
+			device.GroupMembers = devGroup.Devices
+
+			app.powerManager.SetGroupMembers(devGroup.DeviceId, devGroup.Devices)
+		}
+
 		app.powerManager.Register(deviceConf.DeviceId, snapshot.ProbablyTurnedOn)
 
+		if deviceConf.MinOnSeconds < 0 || deviceConf.MinOffSeconds < 0 || deviceConf.MaxSwitchesPerHour < 0 {
+			return fmt.Errorf("device %s: power limits cannot be negative", deviceConf.DeviceId)
+		}
+
+		app.powerManager.SetLimits(deviceConf.DeviceId, powerLimits{
+			minOnTime:          time.Duration(deviceConf.MinOnSeconds) * time.Second,
+			minOffTime:         time.Duration(deviceConf.MinOffSeconds) * time.Second,
+			maxSwitchesPerHour: deviceConf.MaxSwitchesPerHour,
+		})
+
 		device.LinkQualityMetric = app.constMetrics.Register(
 			"ha_link_quality",
 			"Link quality [%]",
@@ -492,28 +906,181 @@ func configureAppAndStartAdapters(
 		app.deviceById[deviceConf.DeviceId] = device
 	}
 
+	for _, booleanConf := range conf.Booleans {
+		var snapshot *hapitypes.BooleanSnapshot
+		if persisted, found := statefile.Booleans[booleanConf.Id]; found {
+			snapshot = &persisted
+		}
+
+		if err := app.booleans.Declare(booleanConf, snapshot); err != nil {
+			return err
+		}
+	}
+
+	for _, variableConf := range conf.Variables {
+		var snapshot *hapitypes.VariableSnapshot
+		if persisted, found := statefile.Variables[variableConf.Id]; found {
+			snapshot = &persisted
+		}
+
+		if err := app.variables.Declare(variableConf, snapshot); err != nil {
+			return err
+		}
+	}
+
+	for _, person := range conf.Persons {
+		var snapshot *hapitypes.PersonSnapshot
+		if persisted, found := statefile.Persons[person.Id]; found {
+			snapshot = &persisted
+		}
+
+		if err := app.persons.Register(person, snapshot); err != nil {
+			return err
+		}
+	}
+
+	// without persons we can't know, so anybodyHome stays true
+	if anybodyHome, known := app.persons.AnybodyHome(); known {
+		app.booleans.Set("anybodyHome", anybodyHome)
+	}
+
 	for _, subscription := range conf.Subscriptions {
-		if _, exists := app.subscriptions[subscription.Event]; exists {
-			return fmt.Errorf(
-				"two subscriptions for event not yet supported; event: %s",
-				subscription.Event)
+		if err := validateSequenceMode(subscription); err != nil {
+			return err
+		}
+
+		for _, condition := range subscription.Conditions {
+			if err := app.validateCondition(condition); err != nil {
+				return fmt.Errorf("subscription %s: %v", subscription.Event, err)
+			}
+		}
+
+		for _, action := range subscription.Actions {
+			if action.Area != "" {
+				if err := app.validateAreaAction(action); err != nil {
+					return fmt.Errorf("subscription %s: %v", subscription.Event, err)
+				}
+			}
+
+			if isLightVerb(action.Verb) {
+				if err := validateLightAction(action); err != nil {
+					return fmt.Errorf("subscription %s: %v", subscription.Event, err)
+				}
+			}
+
+			if isVariableVerb(action.Verb) {
+				if err := app.validateVariableAction(action); err != nil {
+					return fmt.Errorf("subscription %s: %v", subscription.Event, err)
+				}
+			}
+
+			if action.Verb != "notify" {
+				continue
+			}
+
+			if _, err := parseNotifyTemplate(action.NotifyMessage); err != nil {
+				return fmt.Errorf("subscription %s: notify: %v", subscription.Event, err)
+			}
+		}
+
+		spec, err := parseSchedule(subscription.Event)
+		if err != nil {
+			return err
+		}
+		if spec != nil {
+			var lastFired *time.Time
+			if at, found := statefile.SchedulesLastFired[subscription.Event]; found {
+				lastFired = &at
+			}
+
+			app.schedules.Add(subscription.Event, spec, lastFired, app.clock.Now())
 		}
 
 		// FIXME: how to do this better?
 		tmp := subscription
-		app.subscriptions[subscription.Event] = &tmp
+		app.subscriptions = append(app.subscriptions, &tmp)
 	}
 
-	app.policyEngine = newPolicyEngine(
+	for _, scene := range conf.Scenes {
+		if err := validateScene(scene, app.deviceById); err != nil {
+			return err
+		}
+
+		if err := app.validateSceneId(scene.Id); err != nil {
+			return err
+		}
+
+		if err := app.scenes.Define(scene, false); err != nil {
+			return err
+		}
+	}
+
+	for _, scene := range statefile.Scenes {
+		// configuration may have changed since the scene was captured
+		if err := validateScene(scene, app.deviceById); err != nil {
+			app.logl.Error.Printf("dropping captured scene: %v", err)
+			continue
+		}
+
+		if err := app.validateSceneId(scene.Id); err != nil {
+			app.logl.Error.Printf("dropping captured scene: %v", err)
+			continue
+		}
+
+		if err := app.scenes.Define(scene, true); err != nil {
+			app.logl.Error.Printf("dropping captured scene: %v", err)
+		}
+	}
+
+	for _, heldConf := range conf.HeldStates {
+		trigger, err := newHeldStateTrigger(heldConf, app.deviceById)
+		if err != nil {
+			return err
+		}
+
+		// so an episode that spans a restart doesn't fire again
+		if firedFor, found := statefile.HeldStatesFiredFor[heldConf.Id]; found {
+			trigger.firedFor = firedFor
+		}
+
+		app.heldStates = append(app.heldStates, trigger)
+	}
+
+	for _, dependencyConf := range conf.PowerDependencies {
+		for _, deviceId := range append([]string{dependencyConf.Device}, dependencyConf.Dependents...) {
+			device, found := app.deviceById[deviceId]
+			if !found {
+				return fmt.Errorf("power dependency %s: device %s not found", dependencyConf.Device, deviceId)
+			}
+
+			if !device.DeviceType.Capabilities.Power {
+				return fmt.Errorf("power dependency %s: device %s does not support power", dependencyConf.Device, deviceId)
+			}
+		}
+
+		if err := app.powerManager.AddDependency(dependencyConf); err != nil {
+			return err
+		}
+	}
+
+	policyEngine, err := newPolicyEngine(
 		app.booleans,
+		conf.Policies,
 		func(key string) *hapitypes.Device {
 			return app.deviceById[key]
-		})
+		},
+		app.clock,
+		logex.Levels(logex.Prefix("policyEngine", logger)))
+	if err != nil {
+		return err
+	}
+
+	app.policyEngine = policyEngine
 
 	return nil
 }
 
-func runServer(logger *log.Logger, stop *stopper.Stopper) error {
+func runServer(logger *log.Logger, dryRun bool, stop *stopper.Stopper) error {
 	defer stop.Done()
 
 	logl := logex.Levels(logger)
@@ -523,14 +1090,30 @@ func runServer(logger *log.Logger, stop *stopper.Stopper) error {
 		return confErr
 	}
 
+	journalPath := eventJournalPath
+	if dryRun {
+		journalPath = dryRunEventJournalPath
+	}
+
+	journal, err := eventjournal.Open(journalPath, logex.Levels(logex.Prefix("journal", logger)))
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
 	workers := stopper.NewManager()
 
 	defer logl.Info.Println("all components stopped")
 
 	// FIXME: main loop probably shouldn't start here, since there's a race condition
-	app := NewApplication(logex.Prefix("hub", logger), workers.Stopper())
+	app := NewApplication(logex.Prefix("hub", logger), journal, dryRun, workers.Stopper())
+
+	statefile := hapitypes.NewStatefile()
+	if err := jsonfile.Read(statefilePath, &statefile, true); err != nil {
+		return err
+	}
 
-	if err := configureAppAndStartAdapters(app, conf, logger, workers); err != nil {
+	if err := configureAppAndStartAdapters(app, conf, statefile, logger, workers); err != nil {
 		return err
 	}
 
@@ -543,10 +1126,6 @@ func runServer(logger *log.Logger, stop *stopper.Stopper) error {
 	return nil
 }
 
-// needed for ugly isDeviceGroup()
-const deviceGroupDescription = "Device group"
-
-// FIXME: ugly
 func isDeviceGroup(device *hapitypes.Device) bool {
-	return device.Conf.Description == deviceGroupDescription
+	return device.Conf.Type == hapitypes.DeviceGroupType
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDryRunDoesNotWriteStatefile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dryrun")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	workdir, err := os.Getwd()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, os.Chdir(dir) == nil)
+	defer func() { _ = os.Chdir(workdir) }()
+
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	app.dryRun = true
+	assert.Assert(t, app.saveStateSnapshot() == nil)
+	_, err = os.Stat(statefilePath)
+	assert.Assert(t, os.IsNotExist(err))
+
+	app.dryRun = false
+	assert.Assert(t, app.saveStateSnapshot() == nil)
+	_, err = os.Stat(statefilePath)
+	assert.Assert(t, err == nil)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+)
+
+// topics are colon-separated, like "contact:frontDoor:false". in subscription patterns
+// "*" and "+" match any single segment, so "contact:+:false" matches all contact sensors
+func topicMatches(pattern string, topic string) bool {
+	patternSegments := strings.Split(pattern, ":")
+	topicSegments := strings.Split(topic, ":")
+
+	if len(patternSegments) != len(topicSegments) {
+		return false
+	}
+
+	for i, patternSegment := range patternSegments {
+		if patternSegment == "*" || patternSegment == "+" {
+			continue
+		}
+
+		if patternSegment != topicSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
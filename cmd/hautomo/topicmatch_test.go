@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"testing"
+)
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		matches bool
+	}{
+		{"motion:kitchenMotion:true", "motion:kitchenMotion:true", true},
+		{"motion:kitchenMotion:true", "motion:kitchenMotion:false", false},
+		{"motion:kitchenMotion:true", "motion:bedroomMotion:true", false},
+		{"pushbutton:*:double", "pushbutton:hallButton:double", true},
+		{"pushbutton:*:double", "pushbutton:hallButton:single", false},
+		{"contact:+:false", "contact:frontDoor:false", true},
+		{"contact:+:false", "contact:frontDoor:true", false},
+		{"contact:+", "contact:frontDoor:false", false},
+		{"vibration:*", "vibration:washingMachine", true},
+		{"*:*:*", "boolean:anybodyHome:changes-to-true", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.topic, func(t *testing.T) {
+			assert.Assert(t, topicMatches(test.pattern, test.topic) == test.matches)
+		})
+	}
+}
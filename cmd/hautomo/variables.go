@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+)
+
+// setVariable/incrementVariable/decrementVariable/cycleVariable
+func (a *Application) runVariableAction(action hapitypes.ActionConfig) error {
+	amount := action.Amount
+	if amount == 0 {
+		amount = 1
+	}
+
+	var value string
+	var changed bool
+	var err error
+
+	switch action.Verb {
+	case "setVariable":
+		value, changed, err = a.variables.Set(action.Variable, action.Value)
+	case "incrementVariable":
+		value, changed, err = a.variables.Increment(action.Variable, amount)
+	case "decrementVariable":
+		value, changed, err = a.variables.Increment(action.Variable, -amount)
+	case "cycleVariable":
+		value, changed, err = a.variables.Cycle(action.Variable)
+	default:
+		return fmt.Errorf("unknown verb: %s", action.Verb)
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	a.publishFromSequence(fmt.Sprintf("var:%s:changes-to:%s", action.Variable, value))
+
+	return nil
+}
+
+// catches config mistakes on startup instead of when the action first runs
+func (a *Application) validateVariableAction(action hapitypes.ActionConfig) error {
+	conf, err := a.variables.Conf(action.Variable)
+	if err != nil {
+		return fmt.Errorf("%s: %v", action.Verb, err)
+	}
+
+	isEnum := conf.Type == variableTypeEnum
+
+	switch action.Verb {
+	case "setVariable":
+		if _, err := normalizeVariableValue(conf, action.Value); err != nil {
+			return fmt.Errorf("%s %s: %v", action.Verb, action.Variable, err)
+		}
+	case "incrementVariable", "decrementVariable":
+		if isEnum {
+			return fmt.Errorf("%s %s: cannot increment enum", action.Verb, action.Variable)
+		}
+	case "cycleVariable":
+		if !isEnum {
+			return fmt.Errorf("%s %s: can only cycle enum", action.Verb, action.Variable)
+		}
+	}
+
+	return nil
+}
+
+func isVariableVerb(verb string) bool {
+	switch verb {
+	case "setVariable", "incrementVariable", "decrementVariable", "cycleVariable":
+		return true
+	default:
+		return false
+	}
+}
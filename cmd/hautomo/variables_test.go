@@ -0,0 +1,171 @@
+package main
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"testing"
+	"time"
+)
+
+func TestVariableStorage(t *testing.T) {
+	variables := newVariableStorage(newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+
+	max := 2.5
+	assert.Assert(t, variables.Declare(hapitypes.VariableConfig{Id: "guests", Type: "counter"}, nil) == nil)
+	assert.Assert(t, variables.Declare(hapitypes.VariableConfig{Id: "setpoint", Type: "number", Initial: "1.5", Max: &max}, nil) == nil)
+	assert.Assert(t, variables.Declare(hapitypes.VariableConfig{Id: "houseMode", Type: "enum", Values: []string{"home", "away", "night"}}, &hapitypes.VariableSnapshot{
+		Value: "night",
+	}) == nil)
+
+	value := func(id string) string {
+		val, err := variables.Get(id)
+		assert.Assert(t, err == nil)
+		return val
+	}
+
+	assert.EqualString(t, value("guests"), "0")
+	assert.EqualString(t, value("setpoint"), "1.5")
+	assert.EqualString(t, value("houseMode"), "night") // restored
+
+	// counter doesn't go below zero
+	_, changed, err := variables.Increment("guests", -1)
+	assert.Assert(t, err == nil && !changed)
+	newValue, changed, err := variables.Increment("guests", 2)
+	assert.Assert(t, err == nil && changed)
+	assert.EqualString(t, newValue, "2")
+	assert.EqualString(t, value("guests"), "2")
+
+	// clamped to max
+	newValue, _, err = variables.Increment("setpoint", 5)
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, newValue, "2.5")
+	assert.EqualString(t, value("setpoint"), "2.5")
+
+	// wraps around
+	newValue, _, err = variables.Cycle("houseMode")
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, newValue, "home")
+	assert.EqualString(t, value("houseMode"), "home")
+
+	_, _, err = variables.Set("houseMode", "vacation")
+	assert.EqualString(t, err.Error(), "variable houseMode: vacation not one of [home away night]")
+
+	_, _, err = variables.Set("guests", "1.5")
+	assert.EqualString(t, err.Error(), "variable guests: counter must be an integer: 1.5")
+
+	_, _, err = variables.Cycle("guests")
+	assert.EqualString(t, err.Error(), "variable guests: can only cycle enum")
+
+	_, _, err = variables.Increment("houseMode", 1)
+	assert.EqualString(t, err.Error(), "variable houseMode: cannot increment enum")
+
+	assert.EqualString(
+		t,
+		variables.Declare(hapitypes.VariableConfig{Id: "lights", Type: "enum"}, nil).Error(),
+		"variable lights: enum needs values")
+	assert.EqualString(
+		t,
+		variables.Declare(hapitypes.VariableConfig{Id: "guests", Type: "counter"}, nil).Error(),
+		"duplicate variable guests")
+}
+
+func TestVariableActionsAndConditions(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	app.spawn = func(fn func()) { fn() }
+
+	two := 2.0
+
+	assert.Assert(t, configureApp(app, &hapitypes.ConfigFile{
+		Variables: []hapitypes.VariableConfig{
+			{Id: "houseMode", Type: "enum", Values: []string{"home", "away", "night"}},
+			{Id: "guests", Type: "counter"},
+			{Id: "nightsCounted", Type: "counter"},
+		},
+		Subscriptions: []hapitypes.SubscribeConfig{
+			{
+				Event:   "custom:bedtime",
+				Actions: []hapitypes.ActionConfig{{Verb: "setVariable", Variable: "houseMode", Value: "night"}},
+			},
+			{
+				Event:   "custom:guest-arrived",
+				Actions: []hapitypes.ActionConfig{{Verb: "incrementVariable", Variable: "guests"}},
+			},
+			{
+				// change events are published
+				Event: "var:houseMode:changes-to:night",
+				Conditions: []hapitypes.ConditionConfig{
+					{Type: "variable-threshold", Variable: "guests", Below: &two},
+				},
+				Actions: []hapitypes.ActionConfig{{Verb: "incrementVariable", Variable: "nightsCounted"}},
+			},
+		},
+	}, hapitypes.NewStatefile(), logex.Discard, func(*hapitypes.Adapter) error { return nil }) == nil)
+
+	value := func(id string) string {
+		val, err := app.variables.Get(id)
+		assert.Assert(t, err == nil)
+		return val
+	}
+
+	// change events go through the main loop, like they do in production
+	publish := func(event string) {
+		app.publish(event)
+
+		for len(app.inbound.Ch) > 0 {
+			app.handleIncomingEvent(<-app.inbound.Ch)
+		}
+	}
+
+	publish("custom:guest-arrived")
+	publish("custom:bedtime")
+
+	assert.EqualString(t, value("houseMode"), "night")
+	assert.EqualString(t, value("nightsCounted"), "1")
+
+	assert.Assert(t, app.conditionsPass([]hapitypes.ConditionConfig{{Type: "variable-is", Variable: "houseMode", Value: "night"}}))
+	assert.Assert(t, app.conditionsPass([]hapitypes.ConditionConfig{{Type: "variable-is", Variable: "guests", Value: "1.0"}}))
+	assert.Assert(t, !app.conditionsPass([]hapitypes.ConditionConfig{{Type: "variable-not-changed-within", Variable: "houseMode", DurationSeconds: 60}}))
+
+	// setting to same value doesn't publish a change
+	publish("custom:bedtime")
+	assert.EqualString(t, value("nightsCounted"), "1")
+
+	snapshot := app.variables.Snapshot()
+	assert.EqualString(t, snapshot["houseMode"].Value, "night")
+}
+
+func TestValidateVariableAction(t *testing.T) {
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	assert.Assert(t, app.variables.Declare(hapitypes.VariableConfig{Id: "houseMode", Type: "enum", Values: []string{"home", "away"}}, nil) == nil)
+
+	validate := func(action hapitypes.ActionConfig) string {
+		if err := app.validateVariableAction(action); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "cycleVariable", Variable: "houseMode"}), "")
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "setVariable", Variable: "houseMode", Value: "party"}), "setVariable houseMode: party not one of [home away]")
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "incrementVariable", Variable: "houseMode"}), "incrementVariable houseMode: cannot increment enum")
+	assert.EqualString(t, validate(hapitypes.ActionConfig{Verb: "cycleVariable", Variable: "mode"}), "cycleVariable: variable mode does not exist")
+}
+
+func TestVariableIsConditionIsNotClamped(t *testing.T) {
+	ten := 10.0
+
+	app := newApplication(logex.Discard, nil, newSimulatedClock(time.Date(2019, 11, 3, 3, 0, 0, 0, time.UTC)))
+	assert.Assert(t, app.variables.Declare(hapitypes.VariableConfig{Id: "guests", Type: "counter", Max: &ten, Initial: "10"}, nil) == nil)
+
+	is := func(value string) hapitypes.ConditionConfig {
+		return hapitypes.ConditionConfig{Type: "variable-is", Variable: "guests", Value: value}
+	}
+
+	assert.Assert(t, app.conditionsPass([]hapitypes.ConditionConfig{is("10")}))
+	assert.Assert(t, !app.conditionsPass([]hapitypes.ConditionConfig{is("15")}))
+
+	assert.Assert(t, app.validateCondition(is("10")) == nil)
+	assert.EqualString(t, app.validateCondition(is("15")).Error(), "condition variable-is: guests: 15 above max 10")
+	assert.EqualString(t, app.validateCondition(is("-1")).Error(), "condition variable-is: guests: -1 below min 0")
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	variableTypeCounter = "counter" // integer, never below zero (unless min says otherwise)
+	variableTypeNumber  = "number"
+	variableTypeEnum    = "enum"
+)
+
+// like booleanStorage, but for typed values. values are kept in their canonical string
+// form (which is also what change events carry), f.ex. "3", "21.5" or "night"
+type variableStorage struct {
+	variables map[string]*variable
+	clock     clock
+	mu        sync.Mutex
+}
+
+type variable struct {
+	conf       hapitypes.VariableConfig
+	value      string
+	lastChange time.Time
+}
+
+// for UI
+type variableStatus struct {
+	Name       string
+	Type       string
+	Value      string
+	LastChange time.Time
+}
+
+func newVariableStorage(clock clock) *variableStorage {
+	return &variableStorage{
+		variables: map[string]*variable{},
+		clock:     clock,
+	}
+}
+
+// value is restored from snapshot if there is one (and it's still valid for the config)
+func (v *variableStorage) Declare(conf hapitypes.VariableConfig, snapshot *hapitypes.VariableSnapshot) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if conf.Id == "" {
+		return fmt.Errorf("variable without id")
+	}
+
+	if _, exists := v.variables[conf.Id]; exists {
+		return fmt.Errorf("duplicate variable %s", conf.Id)
+	}
+
+	initial := conf.Initial
+
+	switch conf.Type {
+	case variableTypeCounter:
+		if conf.Min == nil {
+			zero := 0.0
+			conf.Min = &zero
+		}
+		fallthrough
+	case variableTypeNumber:
+		if initial == "" {
+			initial = "0"
+		}
+	case variableTypeEnum:
+		if len(conf.Values) == 0 {
+			return fmt.Errorf("variable %s: enum needs values", conf.Id)
+		}
+
+		if initial == "" {
+			initial = conf.Values[0]
+		}
+	default:
+		return fmt.Errorf("variable %s: unknown type: %s", conf.Id, conf.Type)
+	}
+
+	value, err := normalizeVariableValue(conf, initial)
+	if err != nil {
+		return fmt.Errorf("variable %s: initial: %v", conf.Id, err)
+	}
+
+	declared := &variable{
+		conf:  conf,
+		value: value,
+	}
+
+	if snapshot != nil {
+		// config may have changed since the value was persisted
+		if restored, err := normalizeVariableValue(conf, snapshot.Value); err == nil {
+			declared.value = restored
+			declared.lastChange = snapshot.LastChange
+		}
+	}
+
+	v.variables[conf.Id] = declared
+
+	return nil
+}
+
+func (v *variableStorage) Conf(id string) (hapitypes.VariableConfig, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return hapitypes.VariableConfig{}, err
+	}
+
+	return variable.conf, nil
+}
+
+func (v *variableStorage) Get(id string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return "", err
+	}
+
+	return variable.value, nil
+}
+
+func (v *variableStorage) GetNumber(id string) (float64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return 0, err
+	}
+
+	if variable.conf.Type == variableTypeEnum {
+		return 0, fmt.Errorf("variable %s is not a number", id)
+	}
+
+	return strconv.ParseFloat(variable.value, 64)
+}
+
+func (v *variableStorage) GetLastChangeTime(id string) (time.Time, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return variable.lastChange, nil
+}
+
+// returns the new value, and true if it changed. the value is returned from under the
+// lock, so a concurrent change can't slip in between
+func (v *variableStorage) Set(id string, to string) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, err := normalizeVariableValue(variable.conf, to)
+	if err != nil {
+		return "", false, fmt.Errorf("variable %s: %v", id, err)
+	}
+
+	return value, v.change(variable, value), nil
+}
+
+// use negative amount to decrement. result is clamped to min/max
+func (v *variableStorage) Increment(id string, amount float64) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return "", false, err
+	}
+
+	if variable.conf.Type == variableTypeEnum {
+		return "", false, fmt.Errorf("variable %s: cannot increment enum", id)
+	}
+
+	current, err := strconv.ParseFloat(variable.value, 64)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, err := normalizeVariableValue(variable.conf, formatVariableNumber(current+amount))
+	if err != nil {
+		return "", false, fmt.Errorf("variable %s: %v", id, err)
+	}
+
+	return value, v.change(variable, value), nil
+}
+
+// moves enum to its next value, wrapping around
+func (v *variableStorage) Cycle(id string) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	variable, err := v.get(id)
+	if err != nil {
+		return "", false, err
+	}
+
+	if variable.conf.Type != variableTypeEnum {
+		return "", false, fmt.Errorf("variable %s: can only cycle enum", id)
+	}
+
+	values := variable.conf.Values
+
+	next := values[0]
+	for i, value := range values {
+		if value == variable.value {
+			next = values[(i+1)%len(values)]
+			break
+		}
+	}
+
+	return next, v.change(variable, next), nil
+}
+
+func (v *variableStorage) All() map[string]string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	values := map[string]string{}
+	for id, variable := range v.variables {
+		values[id] = variable.value
+	}
+
+	return values
+}
+
+func (v *variableStorage) Snapshot() map[string]hapitypes.VariableSnapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	snapshot := map[string]hapitypes.VariableSnapshot{}
+	for id, variable := range v.variables {
+		snapshot[id] = hapitypes.VariableSnapshot{
+			Value:      variable.value,
+			LastChange: variable.lastChange,
+		}
+	}
+
+	return snapshot
+}
+
+func (v *variableStorage) Statuses() []variableStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	statuses := []variableStatus{}
+	for id, variable := range v.variables {
+		statuses = append(statuses, variableStatus{
+			Name:       id,
+			Type:       variable.conf.Type,
+			Value:      variable.value,
+			LastChange: variable.lastChange,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// must be called with mu held
+func (v *variableStorage) get(id string) (*variable, error) {
+	variable, exists := v.variables[id]
+	if !exists {
+		return nil, fmt.Errorf("variable %s does not exist", id)
+	}
+
+	return variable, nil
+}
+
+func (v *variableStorage) change(variable *variable, to string) bool {
+	if variable.value == to {
+		return false
+	}
+
+	variable.value = to
+	variable.lastChange = v.clock.Now()
+
+	return true
+}
+
+// validates value and returns it in canonical form. numbers are clamped to min/max
+func normalizeVariableValue(conf hapitypes.VariableConfig, value string) (string, error) {
+	return canonicalizeVariableValue(conf, value, true)
+}
+
+// like normalizeVariableValue(), but numbers outside min/max are errors. for comparisons,
+// where clamping would make f.ex. 15 match a variable at its max of 10
+func canonicalVariableValue(conf hapitypes.VariableConfig, value string) (string, error) {
+	return canonicalizeVariableValue(conf, value, false)
+}
+
+func canonicalizeVariableValue(conf hapitypes.VariableConfig, value string, clamp bool) (string, error) {
+	if conf.Type == variableTypeEnum {
+		for _, allowed := range conf.Values {
+			if allowed == value {
+				return value, nil
+			}
+		}
+
+		return "", fmt.Errorf("%s not one of %v", value, conf.Values)
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return "", fmt.Errorf("not a number: %s", value)
+	}
+
+	if conf.Type == variableTypeCounter && number != math.Trunc(number) {
+		return "", fmt.Errorf("counter must be an integer: %s", value)
+	}
+
+	if conf.Min != nil && number < *conf.Min {
+		if !clamp {
+			return "", fmt.Errorf("%s below min %s", value, formatVariableNumber(*conf.Min))
+		}
+
+		number = *conf.Min
+	}
+
+	if conf.Max != nil && number > *conf.Max {
+		if !clamp {
+			return "", fmt.Errorf("%s above max %s", value, formatVariableNumber(*conf.Max))
+		}
+
+		number = *conf.Max
+	}
+
+	return formatVariableNumber(number), nil
+}
+
+func formatVariableNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
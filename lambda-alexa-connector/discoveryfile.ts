@@ -7,6 +7,7 @@ import {
 	Device,
 	playbackController,
 	powerController,
+	sceneController,
 } from './types';
 import { assertUnreachable } from './utils';
 
@@ -17,6 +18,7 @@ enum CapabilityCode {
 	ColorController = 'ColorController',
 	PlaybackController = 'PlaybackController',
 	ColorTemperatureController = 'ColorTemperatureController',
+	SceneController = 'SceneController',
 }
 
 interface DiscoveryFileDevice {
@@ -48,6 +50,8 @@ export function toAlexaStruct(file: DiscoveryFile): Device[] {
 							return playbackController();
 						case CapabilityCode.ColorTemperatureController:
 							return colorTemperatureController();
+						case CapabilityCode.SceneController:
+							return sceneController();
 						default:
 							return assertUnreachable(code);
 					}
@@ -6,6 +6,7 @@ const s3 = new AWS.S3({ apiVersion: '2006-03-01' });
 import { resolveUser } from './amazonuserresolver';
 import { DiscoveryFile, toAlexaStruct } from './discoveryfile';
 import {
+	activateSceneMessage,
 	brightnessMessage,
 	colorMessage,
 	colorTemperature,
@@ -24,6 +25,8 @@ import {
 	AlexaPlaybackInput,
 	AlexaPowerInput,
 	AlexaPowerOutput,
+	AlexaSceneInput,
+	AlexaSceneOutput,
 	LambdaCallback,
 	WarmupMsg,
 } from './types';
@@ -207,6 +210,38 @@ function handleColorTemperatureControl(
 	});
 }
 
+function handleSceneControl(
+	request: AlexaSceneInput,
+): Promise<ProcessResult<AlexaSceneOutput>> {
+	if (request.header.name !== 'Activate') {
+		return Promise.resolve({ error: new Error('Unexpected directive') });
+	}
+
+	return Promise.resolve({
+		piMsg: {
+			msg: activateSceneMessage(request.endpoint.endpointId),
+			queue: request.endpoint.cookie.queue,
+		},
+		response: {
+			context: {},
+			event: {
+				header: {
+					namespace: AlexaNamespace.SceneController,
+					name: 'ActivationStarted',
+					payloadVersion: '3',
+					messageId: uuidv4(),
+					correlationToken: request.header.correlationToken,
+				},
+				endpoint: request.endpoint,
+				payload: {
+					cause: { type: 'VOICE_INTERACTION' },
+					timestamp: new Date().toISOString(),
+				},
+			},
+		},
+	});
+}
+
 function isWarmupMsg(input: any): input is WarmupMsg {
 	return 'warmup' in input;
 }
@@ -251,6 +286,8 @@ export function processEvent(
 				return handleColorTemperatureControl(
 					directive as AlexaColorTemperatureInput,
 				);
+			case AlexaNamespace.SceneController:
+				return handleSceneControl(directive as AlexaSceneInput);
 			default: {
 				// unexpected message
 				assertUnreachable(directive.header.namespace);
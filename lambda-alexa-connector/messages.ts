@@ -47,6 +47,10 @@ export function playbackControlMessage(
 	return 'playback ' + JSON.stringify({ id: applianceId, action });
 }
 
+export function activateSceneMessage(sceneId: string): string {
+	return 'activate_scene ' + JSON.stringify({ id: sceneId });
+}
+
 // helpers
 
 function hsvToRgb(h: number, s: number, v: number): number[] {
@@ -11,6 +11,7 @@ export enum AlexaNamespace {
 	ColorController = 'Alexa.ColorController',
 	PlaybackController = 'Alexa.PlaybackController',
 	ColorTemperatureController = 'Alexa.ColorTemperatureController',
+	SceneController = 'Alexa.SceneController',
 }
 
 // https://developer.amazon.com/docs/device-apis/alexa-discovery.html#display-categories
@@ -19,6 +20,7 @@ export enum Category {
 	TV = 'TV',
 	OTHER = 'OTHER',
 	SPEAKER = 'SPEAKER',
+	SCENE_TRIGGER = 'SCENE_TRIGGER',
 }
 
 export interface AlexaInterface {
@@ -27,6 +29,7 @@ export interface AlexaInterface {
 	version: '3';
 	properties?: any;
 	supportedOperations?: string[];
+	supportsDeactivation?: boolean;
 }
 
 export interface Device {
@@ -183,6 +186,38 @@ export interface AlexaColorTemperatureInput {
 	};
 }
 
+// Scene
+
+export interface AlexaSceneInput {
+	header: {
+		namespace: AlexaNamespace.SceneController;
+		name: 'Activate';
+		payloadVersion: string;
+		messageId: string;
+		correlationToken: string;
+	};
+	endpoint: EndpointSpec;
+	payload: {};
+}
+
+export interface AlexaSceneOutput {
+	context: {};
+	event: {
+		header: {
+			namespace: AlexaNamespace.SceneController;
+			name: 'ActivationStarted';
+			payloadVersion: string; // TODO: '3'
+			messageId: string;
+			correlationToken: string;
+		};
+		endpoint: EndpointSpec;
+		payload: {
+			cause: { type: 'VOICE_INTERACTION' };
+			timestamp: string;
+		};
+	};
+}
+
 // factories for various AlexaInterface structs
 
 export function powerController(): AlexaInterface {
@@ -245,3 +280,12 @@ export function colorTemperatureController(): AlexaInterface {
 		},
 	};
 }
+
+export function sceneController(): AlexaInterface {
+	return {
+		type: 'AlexaInterface',
+		interface: AlexaNamespace.SceneController,
+		version: '3',
+		supportsDeactivation: false,
+	};
+}
@@ -63,26 +63,58 @@ func createAlexaConnectorSpec(sqsAdapter hapitypes.AdapterConfig, conf *hapitype
 			return nil, fmt.Errorf("unsupported AlexaCategory: %s", device.AlexaCategory)
 		}
 
-		deviceType, err := hapitypes.ResolveDeviceType(device.Type)
+		caps, err := hapitypes.ResolveCapabilities(device.DeviceId, conf)
 		if err != nil {
 			return nil, err
 		}
 
-		caps := deviceType.Capabilities
-
-		alexaCapabilities := []string{}
-		maybePushCap(&alexaCapabilities, caps.Power, "PowerController")
-		maybePushCap(&alexaCapabilities, caps.Brightness, "BrightnessController")
-		maybePushCap(&alexaCapabilities, caps.Color, "ColorController")
-		maybePushCap(&alexaCapabilities, caps.ColorTemperature, "ColorTemperatureController")
-		maybePushCap(&alexaCapabilities, caps.Playback, "PlaybackController")
-
 		devices = append(devices, AlexaConnectorDevice{
 			Id:              device.DeviceId,
 			FriendlyName:    device.Name,
 			Description:     device.Description,
 			DisplayCategory: device.AlexaCategory,
-			CapabilityCodes: alexaCapabilities,
+			CapabilityCodes: alexaCapabilityCodes(caps),
+		})
+	}
+
+	if err := hapitypes.ValidateAreas(conf); err != nil {
+		return nil, err
+	}
+
+	for _, area := range conf.Areas {
+		if area.AlexaCategory == "" { // = hide from Alexa
+			continue
+		}
+
+		if _, ok := supportedDisplayCategories[area.AlexaCategory]; !ok {
+			return nil, fmt.Errorf("unsupported AlexaCategory: %s", area.AlexaCategory)
+		}
+
+		caps, err := hapitypes.ResolveAreaCapabilities(area.Id, conf)
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, AlexaConnectorDevice{
+			Id:              area.Id,
+			FriendlyName:    area.Name,
+			Description:     "Area",
+			DisplayCategory: area.AlexaCategory,
+			CapabilityCodes: alexaCapabilityCodes(caps),
+		})
+	}
+
+	for _, scene := range conf.Scenes {
+		if !scene.Alexa {
+			continue
+		}
+
+		devices = append(devices, AlexaConnectorDevice{
+			Id:              scene.Id,
+			FriendlyName:    scene.Name,
+			Description:     "Scene",
+			DisplayCategory: "SCENE_TRIGGER",
+			CapabilityCodes: []string{"SceneController"},
 		})
 	}
 
@@ -113,6 +145,17 @@ func uploadAlexaConnectorSpec(userTokenHash string, spec AlexaConnectorSpec, acc
 	return err
 }
 
+func alexaCapabilityCodes(caps hapitypes.Capabilities) []string {
+	alexaCapabilities := []string{}
+	maybePushCap(&alexaCapabilities, caps.Power, "PowerController")
+	maybePushCap(&alexaCapabilities, caps.Brightness, "BrightnessController")
+	maybePushCap(&alexaCapabilities, caps.Color, "ColorController")
+	maybePushCap(&alexaCapabilities, caps.ColorTemperature, "ColorTemperatureController")
+	maybePushCap(&alexaCapabilities, caps.Playback, "PlaybackController")
+
+	return alexaCapabilities
+}
+
 func maybePushCap(ref *[]string, hasCapability bool, capStr string) {
 	if hasCapability {
 		*ref = append(*ref, capStr)
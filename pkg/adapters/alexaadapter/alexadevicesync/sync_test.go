@@ -30,6 +30,10 @@ func TestCreateAlexaConnectorSpec(t *testing.T) {
 				Type:          "ledstrip-rgbw",
 			},
 		},
+		Scenes: []hapitypes.SceneConfig{
+			{Id: "movie", Name: "Movie night", Alexa: true},
+			{Id: "hidden", Name: "Not exposed"},
+		},
 	}
 
 	spec, err := createAlexaConnectorSpec(conf.Adapters[0], conf)
@@ -60,7 +64,54 @@ func TestCreateAlexaConnectorSpec(t *testing.T) {
         "BrightnessController",
         "ColorController"
       ]
+    },
+    {
+      "id": "movie",
+      "friendly_name": "Movie night",
+      "description": "Scene",
+      "display_category": "SCENE_TRIGGER",
+      "capability_codes": [
+        "SceneController"
+      ]
     }
   ]
 }`)
 }
+
+func TestCreateAlexaConnectorSpecWithAreas(t *testing.T) {
+	conf := &hapitypes.ConfigFile{
+		Adapters: []hapitypes.AdapterConfig{
+			{SqsQueueUrl: "http://dummy.com/queue", SqsAlexaUsertokenHash: "usertokenhash"},
+		},
+		Areas: []hapitypes.AreaConfig{
+			{Id: "kitchen", Name: "Kitchen", AlexaCategory: "LIGHT"},
+			{Id: "hidden", Name: "Not exposed"},
+		},
+		Devices: []hapitypes.DeviceConfig{
+			{DeviceId: "tv", Type: "onkyo-tx-nr515", Area: "kitchen"},
+			{DeviceId: "strip", Type: "ledstrip-rgbw", Area: "kitchen"},
+			{DeviceId: "plug", Type: "ikea-trådfri-smartplug", Area: "hidden"},
+		},
+	}
+
+	spec, err := createAlexaConnectorSpec(conf.Adapters[0], conf)
+	assert.Assert(t, err == nil)
+
+	assert.Assert(t, len(spec.Devices) == 1)
+
+	jsonBytes, err := json.MarshalIndent(spec.Devices[0], "", "  ")
+	assert.Assert(t, err == nil)
+
+	// union of devices' capabilities
+	assert.EqualString(t, string(jsonBytes), `{
+  "id": "kitchen",
+  "friendly_name": "Kitchen",
+  "description": "Area",
+  "display_category": "LIGHT",
+  "capability_codes": [
+    "PowerController",
+    "BrightnessController",
+    "ColorController"
+  ]
+}`)
+}
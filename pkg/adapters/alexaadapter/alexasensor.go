@@ -16,6 +16,8 @@ import (
 	"time"
 )
 
+const commandResultTimeout = 30 * time.Second
+
 type TurnOnRequest struct {
 	DeviceIdOrDeviceGroupId string `json:"id"`
 }
@@ -46,6 +48,10 @@ type ColorTemperatureRequest struct {
 	ColorTemperatureInKelvin uint   `json:"colorTemperatureInKelvin"`
 }
 
+type SceneActivationRequest struct {
+	SceneId string `json:"id"`
+}
+
 func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 	defer stop.Done()
 
@@ -116,7 +122,7 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewPowerEvent(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewPowerEvent(
 				req.DeviceIdOrDeviceGroupId,
 				hapitypes.PowerKindOn,
 				true))
@@ -126,7 +132,7 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewPowerEvent(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewPowerEvent(
 				req.DeviceIdOrDeviceGroupId,
 				hapitypes.PowerKindOff,
 				true))
@@ -136,7 +142,7 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewColorMsg(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewColorMsg(
 				req.DeviceIdOrDeviceGroupId,
 				hapitypes.NewRGB(req.Red, req.Green, req.Blue)))
 		case "brightness":
@@ -145,7 +151,7 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewBrightnessEvent(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewBrightnessEvent(
 				req.DeviceIdOrDeviceGroupId,
 				req.Brightness))
 		case "playback":
@@ -154,7 +160,7 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewPlaybackEvent(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewPlaybackEvent(
 				req.DeviceIdOrDeviceGroupId,
 				req.Action))
 		case "colorTemperature":
@@ -163,9 +169,17 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 				panic(err)
 			}
 
-			adapter.Receive(hapitypes.NewColorTemperatureEvent(
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewColorTemperatureEvent(
 				req.DeviceIdOrDeviceGroupId,
 				req.ColorTemperatureInKelvin))
+		case "activate_scene":
+			var req SceneActivationRequest
+			if err := json.Unmarshal([]byte(msgJsonBody), &req); err != nil {
+				panic(err)
+			}
+
+			receiveCommand(adapter, *msg.MessageId, hapitypes.NewSceneActivationEvent(
+				req.SceneId))
 		default:
 			adapter.Logl.Error.Printf("unknown msgType: " + msgType)
 		}
@@ -183,6 +197,23 @@ func runOnce(sqsClient *sqs.SQS, adapter *hapitypes.Adapter) {
 	}
 }
 
+// Alexa requests are fire-and-forget (we have no channel back to the Lambda), so all we can
+// do with the result is to log failures
+func receiveCommand(adapter *hapitypes.Adapter, correlationId string, e hapitypes.InboundEvent) {
+	e.Meta().CorrelationId = correlationId
+
+	adapter.CommandResults().Observe(correlationId, commandResultTimeout, func(result *hapitypes.CommandResult) {
+		switch {
+		case result == nil:
+			adapter.Logl.Error.Printf("%s %s: no result within %s", e.InboundEventType(), correlationId, commandResultTimeout)
+		case !result.Succeeded():
+			adapter.Logl.Error.Printf("%s %s to %s failed: %s", e.InboundEventType(), correlationId, result.Device, result.Error)
+		}
+	})
+
+	adapter.Receive(e)
+}
+
 var parseMessageRegexp = regexp.MustCompile(`^([a-zA-Z_0-9]+) (.+)$`)
 
 func parseMessage(input string) (error, string, string) {
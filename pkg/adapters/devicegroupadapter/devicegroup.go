@@ -20,7 +20,7 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 				return
 			case event := <-adapter.Outbound:
 				for _, to := range adapter.Conf.DevicegroupDevices {
-					adapter.Receive(event.RedirectInbound(to))
+					adapter.Receive(hapitypes.RedirectInboundCorrelated(event, to))
 				}
 			}
 		}
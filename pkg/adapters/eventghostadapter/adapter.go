@@ -13,6 +13,7 @@ import (
 type EgReq struct {
 	Event   string
 	Payload []string
+	Done    func(err error) // called with result of sending to the PC
 }
 
 type DeviceConn struct {
@@ -33,6 +34,7 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 		conn, found := clientConns[deviceId]
 		if !found {
 			adapter.Logl.Error.Printf("unknown device %s", deviceId)
+			req.Done(fmt.Errorf("unknown device %s", deviceId))
 			return
 		}
 
@@ -40,6 +42,7 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 		case conn.Requests <- req:
 		default:
 			adapter.Logl.Error.Printf("device %s queue is full; message discarded", deviceId)
+			req.Done(fmt.Errorf("device %s queue is full", deviceId))
 		}
 	}
 
@@ -60,10 +63,12 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 					send(e.Device, EgReq{
 						Event:   "OSD",
 						Payload: []string{e.Message},
+						Done:    func(err error) { adapter.Report(e, err) },
 					})
 				case *hapitypes.PlaybackEvent:
 					send(e.Device, EgReq{
 						Event: "Playback." + e.Action,
+						Done:  func(err error) { adapter.Report(e, err) },
 					})
 				default:
 					adapter.LogUnsupportedEvent(genericEvent)
@@ -163,9 +168,12 @@ func handleClientConnection(
 	for {
 		select {
 		case req := <-reqs.Requests:
-			if err := conn.Send(req.Event, req.Payload); err != nil {
+			err := conn.Send(req.Event, req.Payload)
+			if err != nil {
 				logl.Error.Println(err.Error())
 			}
+
+			req.Done(err)
 		case <-stop.Signal:
 			return
 		}
@@ -39,13 +39,19 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 			case genericEvent := <-adapter.Outbound:
 				switch e := genericEvent.(type) {
 				case *hapitypes.PowerMsg:
-					if err := harmonyHubConnection.HoldAndRelease(e.DeviceId, e.PowerCommand); err != nil {
+					err := harmonyHubConnection.HoldAndRelease(e.DeviceId, e.PowerCommand)
+					if err != nil {
 						adapter.Logl.Error.Printf("HoldAndRelease: %s", err.Error())
 					}
+
+					adapter.Report(e, err)
 				case *hapitypes.InfraredEvent:
-					if err := harmonyHubConnection.HoldAndRelease(e.Device, e.Command); err != nil {
+					err := harmonyHubConnection.HoldAndRelease(e.Device, e.Command)
+					if err != nil {
 						adapter.Logl.Error.Printf("HoldAndRelease: %s", err.Error())
 					}
+
+					adapter.Report(e, err)
 				default:
 					adapter.LogUnsupportedEvent(genericEvent)
 				}
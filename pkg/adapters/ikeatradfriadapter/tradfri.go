@@ -45,24 +45,35 @@ func handleEvent(genericEvent hapitypes.OutboundEvent, coapClient *ikeatradfri.C
 		if responseErr != nil {
 			adapter.Logl.Error.Println(responseErr.Error())
 		}
+
+		adapter.Report(e, responseErr)
 	case *hapitypes.BrightnessMsg:
 		// 0-100 => 0-254
 		to := int(float64(e.Brightness) * 2.54)
 
-		if err := ikeatradfri.Dim(e.DeviceId, to, coapClient); err != nil {
+		err := ikeatradfri.Dim(e.DeviceId, to, coapClient)
+		if err != nil {
 			adapter.Logl.Error.Printf("Dim: %s", err.Error())
 		}
+
+		adapter.Report(e, err)
 	case *hapitypes.ColorMsg:
-		if err := ikeatradfri.SetRGB(e.DeviceId, e.Color.Red, e.Color.Green, e.Color.Blue, coapClient); err != nil {
+		err := ikeatradfri.SetRGB(e.DeviceId, e.Color.Red, e.Color.Green, e.Color.Blue, coapClient)
+		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
 		}
+
+		adapter.Report(e, err)
 	case *hapitypes.ColorTemperatureEvent:
-		if err := ikeatradfri.SetColorTemp(
+		err := ikeatradfri.SetColorTemp(
 			e.Device,
 			e.TemperatureInKelvin,
-			coapClient); err != nil {
+			coapClient)
+		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
 		}
+
+		adapter.Report(e, err)
 	default:
 		adapter.LogUnsupportedEvent(genericEvent)
 	}
@@ -34,9 +34,12 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 func handleEvent(genericEvent hapitypes.OutboundEvent, adapter *hapitypes.Adapter) {
 	switch e := genericEvent.(type) {
 	case *hapitypes.PowerMsg:
-		if err := particleapi.Invoke(adapter.Conf.ParticleId, "rf", e.PowerCommand, adapter.Conf.ParticleAccessToken); err != nil {
+		err := particleapi.Invoke(adapter.Conf.ParticleId, "rf", e.PowerCommand, adapter.Conf.ParticleAccessToken)
+		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
 		}
+
+		adapter.Report(e, err)
 	default:
 		adapter.LogUnsupportedEvent(genericEvent)
 	}
@@ -24,6 +24,7 @@ type ProbeResponse struct {
 
 type Presence struct {
 	Person  string
+	Ip      string
 	Present bool
 }
 
@@ -99,6 +100,7 @@ func probePresence(
 	reportPresent := func(present bool) {
 		presences <- Presence{
 			Person:  pbpd.Person,
+			Ip:      pbpd.Ip,
 			Present: present,
 		}
 	}
@@ -127,7 +129,7 @@ func tickerLoop(
 ) {
 	defer stop.Done()
 
-	personIdPresentMap := map[string]bool{}
+	presentByIp := map[string]bool{} // person can have many devices
 
 	probeCount := len(config.PresenceByPingDevice)
 
@@ -148,16 +150,19 @@ func tickerLoop(
 			for i := 0; i < probeCount; i++ {
 				current := <-presences
 
-				previous, firstResult := personIdPresentMap[current.Person]
+				previous, seenBefore := presentByIp[current.Ip]
 
-				// TODO: have this "different than last one" -check in app
-				if !firstResult || current.Present != previous {
-					adapter.Receive(hapitypes.NewPersonPresenceChangeEvent(
+				// hub fuses presence from all sources, so only report changes per device
+				if !seenBefore || current.Present != previous {
+					e := hapitypes.NewPersonPresenceChangeEvent(
 						current.Person,
-						current.Present))
+						current.Present)
+					e.Via = current.Ip
+
+					adapter.Receive(e)
 				}
 
-				personIdPresentMap[current.Person] = current.Present
+				presentByIp[current.Ip] = current.Present
 			}
 		}
 	}
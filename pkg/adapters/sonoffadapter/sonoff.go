@@ -2,6 +2,7 @@ package sonoffadapter
 
 import (
 	"context"
+	"fmt"
 	"github.com/function61/gokit/stopper"
 	"github.com/function61/hautomo/pkg/hapitypes"
 	"github.com/function61/hautomo/pkg/sonoff"
@@ -34,18 +35,36 @@ func handleEvent(genericEvent hapitypes.OutboundEvent, adapter *hapitypes.Adapte
 		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
 		defer cancel()
 
+		var isOn bool
 		var err error
 
 		if e.On {
-			err = sonoff.TurnOn(ctx, e.DeviceId)
+			isOn, err = sonoff.TurnOn(ctx, e.DeviceId)
 		} else {
-			err = sonoff.TurnOff(ctx, e.DeviceId)
+			isOn, err = sonoff.TurnOff(ctx, e.DeviceId)
 		}
 
 		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
+		} else {
+			// Tasmota responds with the relay's state, so the hub can confirm the command
+			adapter.Receive(hapitypes.NewPowerReportEvent(e.OutMeta().Device, isOn))
+
+			if isOn != e.On {
+				err = fmt.Errorf("relay reported %s after command %s", onOrOff(isOn), onOrOff(e.On))
+			}
 		}
+
+		adapter.Report(e, err)
 	default:
 		adapter.LogUnsupportedEvent(genericEvent)
 	}
 }
+
+func onOrOff(on bool) string {
+	if on {
+		return "on"
+	}
+
+	return "off"
+}
@@ -46,9 +46,12 @@ func handleEvent(genericEvent hapitypes.OutboundEvent, adapter *hapitypes.Adapte
 			req = triones.RequestOff(bluetoothAddr)
 		}
 
-		if err := sendLightRequest(req, adapter.Log); err != nil {
+		err := sendLightRequest(req, adapter.Log)
+		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
 		}
+
+		adapter.Report(e, err)
 	case *hapitypes.BrightnessMsg:
 		lastColor := e.LastColor
 		brightness := e.Brightness
@@ -59,8 +62,11 @@ func handleEvent(genericEvent hapitypes.OutboundEvent, adapter *hapitypes.Adapte
 			uint8(float64(lastColor.Blue)*float64(brightness)/100.0),
 		)
 
-		// translate brightness directives into RGB directives
-		adapter.Send(hapitypes.NewColorMsg(e.DeviceId, dimmedColor))
+		// translate brightness directives into RGB directives (which reports the result in our stead)
+		colorMsg := hapitypes.NewColorMsg(e.DeviceId, dimmedColor)
+		colorMsg.OutboundMeta = e.OutboundMeta
+
+		adapter.Send(colorMsg)
 	case *hapitypes.ColorMsg:
 		bluetoothAddr := e.DeviceId
 
@@ -94,9 +100,12 @@ func handleEvent(genericEvent hapitypes.OutboundEvent, adapter *hapitypes.Adapte
 			}
 		}
 
-		if err := sendLightRequest(req, adapter.Log); err != nil {
+		err = sendLightRequest(req, adapter.Log)
+		if err != nil {
 			adapter.Logl.Error.Println(err.Error())
 		}
+
+		adapter.Report(e, err)
 	default:
 		adapter.LogUnsupportedEvent(genericEvent)
 	}
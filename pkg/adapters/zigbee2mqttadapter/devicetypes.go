@@ -12,6 +12,7 @@ const (
 	deviceKindRTCGQ11LM             // motion sensor
 	deviceKindDJT11LM               // vibration sensor
 	deviceKindE1524                 // Trådfri remote
+	deviceKindLight                 // lights & smartplugs, anything with on/off state
 )
 
 // TODO: how to guarantee that these are kept in-sync?
@@ -24,6 +25,9 @@ var deviceTypeToZ2mType = map[string]deviceKind{
 	"aqara-motion-sensor":        deviceKindRTCGQ11LM,
 	"aqara-vibration-sensor":     deviceKindDJT11LM,
 	"ikea-trådfri-remote":        deviceKindE1524,
+	"ikea-trådfri-noncolored":    deviceKindLight,
+	"ikea-trådfri-rgb":           deviceKindLight,
+	"ikea-trådfri-smartplug":     deviceKindLight,
 }
 
 // {"battery":100,"voltage":3055,"linkquality":47,"click":"double"}
@@ -96,3 +100,9 @@ type E1524 struct {
 	Action      string `json:"action"`
 	LinkQuality uint   `json:"linkquality"`
 }
+
+// {"state":"ON","brightness":254,"linkquality":60}
+type Light struct {
+	State       string `json:"state"` // ON|OFF
+	LinkQuality uint   `json:"linkquality"`
+}
@@ -33,6 +33,7 @@ func parseMsgPayload(topicName string, resolver deviceResolver, message string,
 
 	events := []hapitypes.InboundEvent{}
 	push := func(e hapitypes.InboundEvent) {
+		e.Meta().When = now // origin time is when we got the MQTT message
 		events = append(events, e)
 	}
 
@@ -122,6 +123,20 @@ func parseMsgPayload(topicName string, resolver deviceResolver, message string,
 		}
 
 		push(hapitypes.NewPushButtonEvent(ourId, payload.Action))
+		push(hapitypes.NewLinkQualityEvent(ourId, payload.LinkQuality))
+	case deviceKindLight:
+		payload := Light{}
+		if err := decJson(&payload, message); err != nil {
+			return nil, err
+		}
+
+		switch payload.State {
+		case "ON":
+			push(hapitypes.NewPowerReportEvent(ourId, true))
+		case "OFF":
+			push(hapitypes.NewPowerReportEvent(ourId, false))
+		}
+
 		push(hapitypes.NewLinkQualityEvent(ourId, payload.LinkQuality))
 	case deviceKindUnknown:
 		return nil, fmt.Errorf("unknown device kind for %s", ourId)
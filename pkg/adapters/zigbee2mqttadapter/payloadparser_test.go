@@ -40,14 +40,14 @@ BatteryStatusEvent {"Device":"dummyId","BatteryPct":100,"Voltage":3055}`,
 		{
 			input: `{"contact":true,"linkquality":70}`,
 			kind:  deviceKindMCCGQ11LM,
-			output: `ContactEvent {"Device":"dummyId","Contact":true,"When":"2019-10-25T20:23:00Z"}
+			output: `ContactEvent {"Device":"dummyId","Contact":true}
 LinkQualityEvent {"Device":"dummyId","LinkQuality":70}
 BatteryStatusEvent {"Device":"dummyId","BatteryPct":0,"Voltage":0}`,
 		},
 		{
 			input: `{"contact":false,"linkquality":70}`,
 			kind:  deviceKindMCCGQ11LM,
-			output: `ContactEvent {"Device":"dummyId","Contact":false,"When":"2019-10-25T20:23:00Z"}
+			output: `ContactEvent {"Device":"dummyId","Contact":false}
 LinkQualityEvent {"Device":"dummyId","LinkQuality":70}
 BatteryStatusEvent {"Device":"dummyId","BatteryPct":0,"Voltage":0}`,
 		},
@@ -76,6 +76,17 @@ LinkQualityEvent {"Device":"dummyId","LinkQuality":97}`,
 			output: `PushButtonEvent {"Device":"dummyId","Specifier":"brightness_down_click"}
 LinkQualityEvent {"Device":"dummyId","LinkQuality":34}`,
 		},
+		{
+			input: `{"state":"ON","brightness":254,"linkquality":60}`,
+			kind:  deviceKindLight,
+			output: `PowerReportEvent {"Device":"dummyId","On":true}
+LinkQualityEvent {"Device":"dummyId","LinkQuality":60}`,
+		},
+		{
+			input:  `{"brightness":254,"linkquality":60}`,
+			kind:   deviceKindLight,
+			output: `LinkQualityEvent {"Device":"dummyId","LinkQuality":60}`,
+		},
 		{
 			input:  `{"this is": "unsupported payload type"}`,
 			kind:   deviceKindUnknown,
@@ -96,6 +107,8 @@ LinkQualityEvent {"Device":"dummyId","LinkQuality":34}`,
 			} else {
 				allSerialized := []string{}
 				for _, event := range events {
+					assert.Assert(t, event.Meta().When.Equal(now))
+
 					eventJson, err := json.Marshal(event)
 					assert.Assert(t, err == nil)
 
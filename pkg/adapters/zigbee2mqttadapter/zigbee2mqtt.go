@@ -101,10 +101,14 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 			if deviceConf != nil && caps.Color && caps.ColorTemperature {
 				r, g, b := temperatureToRGB(float64(e.TemperatureInKelvin))
 
-				// re-publish as a RGB message
-				adapter.Outbound <- hapitypes.NewColorMsg(
+				// re-publish as a RGB message (which reports the result in our stead)
+				colorMsg := hapitypes.NewColorMsg(
 					e.Device,
 					hapitypes.NewRGB(r, g, b))
+				colorMsg.OutboundMeta = e.OutboundMeta
+
+				adapter.Send(colorMsg)
+				return
 			} else {
 				z2mPublish <- deviceMsg(e.Device, fmt.Sprintf(
 					`{"color_temp": %d, "transition": 1}`,
@@ -112,7 +116,11 @@ func Start(adapter *hapitypes.Adapter, stop *stopper.Stopper) error {
 			}
 		default:
 			adapter.LogUnsupportedEvent(genericEvent)
+			return
 		}
+
+		// we don't get acks from zigbee2mqtt, so handing it over to MQTT is the best we know
+		adapter.Report(genericEvent, nil)
 	}
 
 	go func() {
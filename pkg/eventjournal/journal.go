@@ -0,0 +1,247 @@
+// append-only, rotating on-disk journal of events flowing through the hub
+package eventjournal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindInbound  = "inbound"
+	KindPublish  = "publish"
+	KindOutbound = "outbound"
+)
+
+const (
+	defaultMaxBytes = 10 * 1024 * 1024
+	defaultMaxFiles = 5 // rotated files kept in addition to the active one
+)
+
+type Entry struct {
+	Timestamp time.Time       `json:"ts"`
+	Kind      string          `json:"kind"`             // inbound | publish | outbound
+	Source    string          `json:"source,omitempty"` // adapter id (or "hub")
+	Type      string          `json:"type,omitempty"`   // f.ex. "MotionEvent"
+	Topic     string          `json:"topic,omitempty"`  // only for publish
+	Event     json.RawMessage `json:"event,omitempty"`
+}
+
+func (e Entry) String() string {
+	what := e.Type
+	if e.Kind == KindPublish {
+		what = e.Topic
+	}
+
+	return strings.TrimRight(fmt.Sprintf(
+		"%s %-8s %-12s %s %s",
+		e.Timestamp.Format(time.RFC3339Nano),
+		e.Kind,
+		e.Source,
+		what,
+		string(e.Event)), " ")
+}
+
+// when active file grows over maxBytes, it's renamed to path.1 (path.1 => path.2 etc.)
+type Journal struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	mu       sync.Mutex
+	logl     *logex.Leveled
+}
+
+func Open(path string, logl *logex.Leveled) (*Journal, error) {
+	j := &Journal{
+		path:     path,
+		maxBytes: defaultMaxBytes,
+		maxFiles: defaultMaxFiles,
+		logl:     logl,
+	}
+
+	return j, j.openActive()
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *Journal) Append(entry Entry) error {
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("journal %s closed", j.path)
+	}
+
+	if j.size+int64(len(line)) > j.maxBytes && j.size > 0 {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	return err
+}
+
+// contract of hapitypes.EventObserver
+func (j *Journal) ObserveInbound(e hapitypes.InboundEvent) {
+	meta := e.Meta()
+	j.appendEvent(meta.When, KindInbound, meta.Source, e.InboundEventType(), e)
+}
+
+// contract of hapitypes.EventObserver
+func (j *Journal) ObserveOutbound(adapterId string, e hapitypes.OutboundEvent) {
+	j.appendEvent(time.Now(), KindOutbound, adapterId, e.OutboundEventType(), e)
+}
+
+func (j *Journal) ObservePublish(topic string) {
+	j.logIfError(j.Append(Entry{
+		Timestamp: time.Now(),
+		Kind:      KindPublish,
+		Source:    hapitypes.InboundSourceHub,
+		Topic:     topic,
+	}))
+}
+
+func (j *Journal) appendEvent(ts time.Time, kind string, source string, typ string, e interface{}) {
+	eventJson, err := json.Marshal(e)
+	if err != nil {
+		j.logIfError(err)
+		return
+	}
+
+	j.logIfError(j.Append(Entry{
+		Timestamp: ts,
+		Kind:      kind,
+		Source:    source,
+		Type:      typ,
+		Event:     eventJson,
+	}))
+}
+
+func (j *Journal) logIfError(err error) {
+	if err != nil {
+		j.logl.Error.Printf("journal: %v", err)
+	}
+}
+
+func (j *Journal) openActive() error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	j.file = file
+	j.size = stat.Size()
+
+	return nil
+}
+
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	j.file = nil
+
+	// oldest one falls off
+	if err := os.Remove(rotatedPath(j.path, j.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := j.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedPath(j.path, i), rotatedPath(j.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(j.path, rotatedPath(j.path, 1)); err != nil {
+		return err
+	}
+
+	return j.openActive()
+}
+
+// reads rotated files and the active file, oldest entry first. malformed lines (f.ex. the
+// last line being cut short by a crash) are logged and skipped
+func Read(path string, logl *logex.Leveled, fn func(entry Entry) error) error {
+	paths := []string{}
+	for i := defaultMaxFiles; i >= 1; i-- {
+		paths = append(paths, rotatedPath(path, i))
+	}
+	paths = append(paths, path)
+
+	for _, filePath := range paths {
+		if err := readOneFile(filePath, logl, fn); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readOneFile(path string, logl *logex.Leveled, fn func(entry Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for lines.Scan() {
+		lineNumber++
+
+		entry := Entry{}
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			logl.Error.Printf("%s:%d: skipping malformed entry: %v", path, lineNumber, err)
+			continue
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return lines.Err()
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
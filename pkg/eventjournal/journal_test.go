@@ -0,0 +1,86 @@
+package eventjournal
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"github.com/function61/hautomo/pkg/hapitypes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalRotatesAndReadsInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventjournal")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+
+	journal, err := Open(path, logex.Levels(logex.Discard))
+	assert.Assert(t, err == nil)
+	journal.maxBytes = 400 // force rotation after a couple of entries
+	journal.maxFiles = 2
+
+	for _, device := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		e := hapitypes.NewMotionEvent(device, true, 0)
+		e.When = time.Now()
+		e.Source = "zigbee"
+
+		journal.ObserveInbound(e)
+	}
+	journal.ObservePublish("motion:h:true")
+	journal.ObserveOutbound("tradfri", hapitypes.NewPowerMsg("65537", "", true))
+
+	assert.Assert(t, journal.Close() == nil)
+
+	_, err = os.Stat(path + ".3")
+	assert.Assert(t, os.IsNotExist(err))
+
+	lines := []string{}
+	assert.Assert(t, Read(path, logex.Levels(logex.Discard), func(entry Entry) error {
+		// cut timestamp for determinism
+		line := entry.String()
+		lines = append(lines, line[strings.Index(line, " ")+1:])
+		return nil
+	}) == nil)
+
+	// oldest entries were rotated away
+	assert.EqualString(t, strings.Join(lines, "\n"), `inbound  zigbee       MotionEvent {"Device":"e","Movement":true,"Illuminance":0}
+inbound  zigbee       MotionEvent {"Device":"f","Movement":true,"Illuminance":0}
+inbound  zigbee       MotionEvent {"Device":"g","Movement":true,"Illuminance":0}
+inbound  zigbee       MotionEvent {"Device":"h","Movement":true,"Illuminance":0}
+publish  hub          motion:h:true
+outbound tradfri      PowerMsg {"DeviceId":"65537","PowerCommand":"","On":true}`)
+}
+
+func TestReadSkipsTruncatedLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventjournal")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+
+	journal, err := Open(path, logex.Levels(logex.Discard))
+	assert.Assert(t, err == nil)
+	journal.ObservePublish("motion:a:true")
+	journal.ObservePublish("motion:b:true")
+	assert.Assert(t, journal.Close() == nil)
+
+	// power was lost mid-write
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Assert(t, err == nil)
+	_, err = file.WriteString(`{"ts":"2019-11-03T03:00:00Z","kind":"pub`)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, file.Close() == nil)
+
+	topics := []string{}
+	assert.Assert(t, Read(path, logex.Levels(logex.Discard), func(entry Entry) error {
+		topics = append(topics, entry.Topic)
+		return nil
+	}) == nil)
+
+	assert.EqualString(t, strings.Join(topics, ", "), "motion:a:true, motion:b:true")
+}
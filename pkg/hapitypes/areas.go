@@ -0,0 +1,110 @@
+package hapitypes
+
+import (
+	"fmt"
+)
+
+func (c *ConfigFile) FindArea(id string) *AreaConfig {
+	for _, area := range c.Areas {
+		if area.Id == id {
+			return &area
+		}
+	}
+
+	return nil
+}
+
+// checks that areas' parents and devices' areas exist, and that there are no cycles. area ids
+// share namespace with device ids, since areas are addressable like devices
+func ValidateAreas(conf *ConfigFile) error {
+	seen := map[string]bool{}
+
+	for _, area := range conf.Areas {
+		if area.Id == "" {
+			return fmt.Errorf("area without id")
+		}
+
+		if seen[area.Id] {
+			return fmt.Errorf("duplicate area %s", area.Id)
+		}
+		seen[area.Id] = true
+
+		if findDeviceConfig(area.Id, conf) != nil || conf.FindDeviceGroup(area.Id) != nil {
+			return fmt.Errorf("area %s: id clashes with a device", area.Id)
+		}
+
+		// walk up the parents
+		path := []string{area.Id}
+		for parentId := area.Parent; parentId != ""; {
+			parent := conf.FindArea(parentId)
+			if parent == nil {
+				return fmt.Errorf("area %s: parent %s not found", area.Id, parentId)
+			}
+
+			for _, visited := range path {
+				if visited == parentId {
+					return fmt.Errorf("area %s: parent cycle via %s", area.Id, parentId)
+				}
+			}
+
+			path = append(path, parentId)
+			parentId = parent.Parent
+		}
+	}
+
+	for _, device := range conf.Devices {
+		if device.Area != "" && conf.FindArea(device.Area) == nil {
+			return fmt.Errorf("device %s: area %s not found", device.DeviceId, device.Area)
+		}
+	}
+
+	return nil
+}
+
+// ids of devices in the area and its sub-areas, in config order
+func AreaDevices(areaId string, conf *ConfigFile) []string {
+	deviceIds := []string{}
+
+	for _, device := range conf.Devices {
+		if device.Area != "" && isWithinArea(device.Area, areaId, conf) {
+			deviceIds = append(deviceIds, device.DeviceId)
+		}
+	}
+
+	return deviceIds
+}
+
+// union of its devices' capabilities, since commands are sent to devices that support them
+func ResolveAreaCapabilities(areaId string, conf *ConfigFile) (Capabilities, error) {
+	union := Capabilities{}
+
+	for _, deviceId := range AreaDevices(areaId, conf) {
+		caps, err := ResolveCapabilities(deviceId, conf)
+		if err != nil {
+			return Capabilities{}, err
+		}
+
+		union = union.Union(caps)
+	}
+
+	return union, nil
+}
+
+// whether area is the other area or (transitively) inside it. ValidateAreas() has already
+// checked for cycles
+func isWithinArea(areaId string, otherAreaId string, conf *ConfigFile) bool {
+	for areaId != "" {
+		if areaId == otherAreaId {
+			return true
+		}
+
+		area := conf.FindArea(areaId)
+		if area == nil {
+			return false
+		}
+
+		areaId = area.Parent
+	}
+
+	return false
+}
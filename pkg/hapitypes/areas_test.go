@@ -0,0 +1,76 @@
+package hapitypes
+
+import (
+	"github.com/function61/gokit/assert"
+	"strings"
+	"testing"
+)
+
+func TestAreaDevicesAndCapabilities(t *testing.T) {
+	conf := &ConfigFile{
+		Areas: []AreaConfig{
+			{Id: "groundFloor"},
+			{Id: "kitchen", Parent: "groundFloor"},
+			{Id: "attic"},
+		},
+		Devices: []DeviceConfig{
+			{DeviceId: "plug", Type: "ikea-trådfri-smartplug", Area: "kitchen"},
+			{DeviceId: "rgb", Type: "ikea-trådfri-rgb", Area: "groundFloor"},
+			{DeviceId: "noncolored", Type: "ikea-trådfri-noncolored"},
+		},
+	}
+
+	assert.Assert(t, ValidateAreas(conf) == nil)
+
+	assert.EqualString(t, strings.Join(AreaDevices("groundFloor", conf), ", "), "plug, rgb")
+	assert.EqualString(t, strings.Join(AreaDevices("kitchen", conf), ", "), "plug")
+	assert.EqualString(t, strings.Join(AreaDevices("attic", conf), ", "), "")
+
+	// union, since commands go to devices that support them
+	caps, err := ResolveAreaCapabilities("groundFloor", conf)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, caps == Capabilities{
+		Power:            true,
+		Brightness:       true,
+		Color:            true,
+		ColorTemperature: true,
+	})
+
+	caps, err = ResolveAreaCapabilities("attic", conf)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, caps == Capabilities{})
+}
+
+func TestValidateAreas(t *testing.T) {
+	validate := func(conf *ConfigFile) string {
+		if err := ValidateAreas(conf); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.EqualString(t, validate(&ConfigFile{
+		Areas: []AreaConfig{{Id: "kitchen"}, {Id: "kitchen"}},
+	}), "duplicate area kitchen")
+
+	assert.EqualString(t, validate(&ConfigFile{
+		Areas:   []AreaConfig{{Id: "kitchen"}},
+		Devices: []DeviceConfig{{DeviceId: "kitchen"}},
+	}), "area kitchen: id clashes with a device")
+
+	assert.EqualString(t, validate(&ConfigFile{
+		Areas: []AreaConfig{{Id: "kitchen", Parent: "groundFloor"}},
+	}), "area kitchen: parent groundFloor not found")
+
+	assert.EqualString(t, validate(&ConfigFile{
+		Areas: []AreaConfig{
+			{Id: "a", Parent: "b"},
+			{Id: "b", Parent: "c"},
+			{Id: "c", Parent: "b"},
+		},
+	}), "area a: parent cycle via b")
+
+	assert.EqualString(t, validate(&ConfigFile{
+		Devices: []DeviceConfig{{DeviceId: "plug", Area: "garage"}},
+	}), "device plug: area garage not found")
+}
@@ -1,6 +1,7 @@
 package hapitypes
 
 type BatteryStatusEvent struct {
+	InboundMeta
 	Device     string
 	BatteryPct uint // 0-100 %
 	Voltage    uint // [mV]
@@ -1,11 +1,13 @@
 package hapitypes
 
 type BlinkEvent struct {
+	InboundMeta
+	OutboundMeta
 	DeviceId string
 }
 
 func NewBlinkEvent(deviceId string) *BlinkEvent {
-	return &BlinkEvent{deviceId}
+	return &BlinkEvent{DeviceId: deviceId}
 }
 
 func (e *BlinkEvent) InboundEventType() string {
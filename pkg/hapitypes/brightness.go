@@ -1,6 +1,7 @@
 package hapitypes
 
 type BrightnessEvent struct {
+	InboundMeta
 	DeviceIdOrDeviceGroupId string
 	Brightness              uint // 0..100 %
 }
@@ -17,6 +18,7 @@ func (e *BrightnessEvent) InboundEventType() string {
 }
 
 type BrightnessMsg struct {
+	OutboundMeta
 	DeviceId   string
 	Brightness uint
 	LastColor  RGB
@@ -37,3 +39,7 @@ func (e *BrightnessMsg) OutboundEventType() string {
 func (e *BrightnessMsg) RedirectInbound(toDeviceId string) InboundEvent {
 	return NewBrightnessEvent(toDeviceId, e.Brightness)
 }
+
+func (e *BrightnessMsg) CoalesceKey() string {
+	return e.OutboundEventType() + ":" + e.DeviceId
+}
@@ -1,6 +1,8 @@
 package hapitypes
 
 type ColorMsg struct {
+	InboundMeta
+	OutboundMeta
 	DeviceId string
 	Color    RGB
 }
@@ -23,3 +25,7 @@ func (e *ColorMsg) OutboundEventType() string {
 func (e *ColorMsg) RedirectInbound(toDeviceId string) InboundEvent {
 	return NewColorMsg(toDeviceId, e.Color)
 }
+
+func (e *ColorMsg) CoalesceKey() string {
+	return e.OutboundEventType() + ":" + e.DeviceId
+}
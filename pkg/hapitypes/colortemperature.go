@@ -1,10 +1,15 @@
 package hapitypes
 
 func NewColorTemperatureEvent(device string, temperatureInKelvin uint) *ColorTemperatureEvent {
-	return &ColorTemperatureEvent{device, temperatureInKelvin}
+	return &ColorTemperatureEvent{
+		Device:              device,
+		TemperatureInKelvin: temperatureInKelvin,
+	}
 }
 
 type ColorTemperatureEvent struct {
+	InboundMeta
+	OutboundMeta
 	Device              string
 	TemperatureInKelvin uint
 }
@@ -20,3 +25,7 @@ func (e *ColorTemperatureEvent) OutboundEventType() string {
 func (e *ColorTemperatureEvent) RedirectInbound(toDeviceId string) InboundEvent {
 	return NewColorTemperatureEvent(toDeviceId, e.TemperatureInKelvin)
 }
+
+func (e *ColorTemperatureEvent) CoalesceKey() string {
+	return e.OutboundEventType() + ":" + e.Device
+}
@@ -0,0 +1,164 @@
+package hapitypes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// outcome of an outbound command, as reported by the adapter that executed it
+type CommandResult struct {
+	CorrelationId string `json:"correlation_id"`
+	Device        string `json:"device"` // hub's device id
+	Adapter       string `json:"adapter"`
+	Type          string `json:"type"` // outbound event type, f.ex. "PowerMsg"
+	Error         string `json:"error,omitempty"`
+
+	// not a result, but an announcement of how many results replace this one (see FanOut())
+	isFanOut bool
+	fanOut   int
+}
+
+func (c CommandResult) Succeeded() bool {
+	return c.Error == ""
+}
+
+// routes adapters' result reports to subscribers by correlation id. one command may produce
+// multiple results (f.ex. a device group has one result per member device).
+type CommandResults struct {
+	subscribers   map[string][]chan CommandResult
+	subscribersMu sync.Mutex
+	metrics       *FabricMetrics
+}
+
+func newCommandResults(metrics *FabricMetrics) *CommandResults {
+	return &CommandResults{
+		subscribers: map[string][]chan CommandResult{},
+		metrics:     metrics,
+	}
+}
+
+func NewCorrelationId() string {
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(randomBytes)
+}
+
+// subscribe before dispatching the command, so you can't miss the result. the returned
+// func must be called when you're no longer interested.
+func (c *CommandResults) Subscribe(correlationId string) (<-chan CommandResult, func()) {
+	ch := make(chan CommandResult, 64) // device groups, scenes and areas have a result per device
+
+	c.subscribersMu.Lock()
+	c.subscribers[correlationId] = append(c.subscribers[correlationId], ch)
+	c.subscribersMu.Unlock()
+
+	return ch, func() {
+		c.subscribersMu.Lock()
+		defer c.subscribersMu.Unlock()
+
+		remaining := []chan CommandResult{}
+		for _, subscriber := range c.subscribers[correlationId] {
+			if subscriber != ch {
+				remaining = append(remaining, subscriber)
+			}
+		}
+
+		if len(remaining) > 0 {
+			c.subscribers[correlationId] = remaining
+		} else {
+			delete(c.subscribers, correlationId)
+		}
+	}
+}
+
+// calls fn (in a separate goroutine) with the first result, or with nil if no result arrived
+// in time. call before dispatching the command.
+func (c *CommandResults) Observe(correlationId string, timeout time.Duration, fn func(result *CommandResult)) {
+	results, unsubscribe := c.Subscribe(correlationId)
+
+	go func() {
+		defer unsubscribe()
+
+		timedOut := time.After(timeout)
+
+		for {
+			select {
+			case result := <-results:
+				if result.isFanOut {
+					continue
+				}
+
+				fn(&result)
+				return
+			case <-timedOut:
+				fn(nil)
+				return
+			}
+		}
+	}()
+}
+
+// the hub is sending the command as count sub-commands (device group's members, scene's or
+// area's devices) with the same correlation id, so one result turns into count results.
+// call before dispatching the sub-commands.
+func (c *CommandResults) FanOut(correlationId string, count int) {
+	c.deliver(CommandResult{
+		CorrelationId: correlationId,
+		isFanOut:      true,
+		fanOut:        count,
+	})
+}
+
+// waits until all of the command's results (see FanOut()) have arrived. returns false if some
+// didn't arrive in time, along with the results that did
+func CollectCommandResults(results <-chan CommandResult, timeout time.Duration) ([]CommandResult, bool) {
+	collected := []CommandResult{}
+	expected := 1
+
+	timedOut := time.After(timeout)
+
+	for len(collected) < expected {
+		select {
+		case result := <-results:
+			if result.isFanOut {
+				expected += result.fanOut - 1
+				continue
+			}
+
+			collected = append(collected, result)
+		case <-timedOut:
+			return collected, false
+		}
+	}
+
+	return collected, true
+}
+
+func (c *CommandResults) Report(result CommandResult) {
+	if !result.Succeeded() {
+		c.metrics.commandFailures.WithLabelValues(result.Device).Inc()
+	}
+
+	c.deliver(result)
+}
+
+func (c *CommandResults) deliver(result CommandResult) {
+	if result.CorrelationId == "" {
+		return
+	}
+
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+
+	for _, subscriber := range c.subscribers[result.CorrelationId] {
+		select {
+		case subscriber <- result:
+		default: // subscriber not keeping up. it will time out
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package hapitypes
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"testing"
+	"time"
+)
+
+func TestCollectCommandResults(t *testing.T) {
+	results := NewInboundFabric(logex.Levels(logex.Discard)).Results
+
+	ch, unsubscribe := results.Subscribe("corr")
+	defer unsubscribe()
+
+	// group "everything" of group "lights" (2 members) and a plug
+	results.FanOut("corr", 2)
+	results.Report(CommandResult{CorrelationId: "corr", Device: "plug"})
+	results.FanOut("corr", 2)
+	results.Report(CommandResult{CorrelationId: "corr", Device: "ceiling", Error: "timeout"})
+	results.Report(CommandResult{CorrelationId: "corr", Device: "desk"})
+
+	collected, complete := CollectCommandResults(ch, time.Second)
+	assert.Assert(t, complete)
+	assert.Assert(t, len(collected) == 3)
+	assert.EqualString(t, collected[1].Error, "timeout")
+
+	// empty group
+	results.FanOut("corr", 0)
+	collected, complete = CollectCommandResults(ch, time.Second)
+	assert.Assert(t, complete && len(collected) == 0)
+
+	results.FanOut("corr", 2)
+	results.Report(CommandResult{CorrelationId: "corr", Device: "plug"})
+	collected, complete = CollectCommandResults(ch, 10*time.Millisecond)
+	assert.Assert(t, !complete && len(collected) == 1)
+}
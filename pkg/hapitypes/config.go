@@ -12,6 +12,9 @@ type AdapterConfig struct {
 	Id   string `json:"id"`
 	Type string `json:"type"`
 
+	OutboundQueueSize int    `json:"outbound_queue_size,omitempty"` // defaults to 32
+	OutboundOverflow  string `json:"outbound_overflow,omitempty"`   // drop-oldest | drop-newest | coalesce (default)
+
 	ParticleId          string `json:"particle_id,omitempty"`
 	ParticleAccessToken string `json:"particle_access_token,omitempty"`
 
@@ -45,6 +48,12 @@ type DeviceConfig struct {
 	PowerOnCmd       string `json:"power_on_cmd,omitempty"`
 	PowerOffCmd      string `json:"power_off_cmd,omitempty"`
 	AlexaCategory    string `json:"alexa_category,omitempty"`
+	Area             string `json:"area,omitempty"`
+
+	// anti-flapping limits for automatic power changes (explicit commands bypass these)
+	MinOnSeconds       int `json:"min_on_seconds,omitempty"`
+	MinOffSeconds      int `json:"min_off_seconds,omitempty"`
+	MaxSwitchesPerHour int `json:"max_switches_per_hour,omitempty"`
 
 	EventghostAddr   string `json:"eventghost_addr,omitempty"` // if specified, we connect to the PC direction for sending events
 	EventghostSecret string `json:"eventghost_secret,omitempty"`
@@ -52,43 +61,148 @@ type DeviceConfig struct {
 
 // these are transparently generated to adapter + device combo
 type DeviceGroupConfig struct {
-	DeviceId string   `json:"device_id"`
-	Name     string   `json:"name"`
-	Devices  []string `json:"devices"`
+	DeviceId      string   `json:"device_id"`
+	Name          string   `json:"name"`
+	Devices       []string `json:"devices"`                  // can contain other groups
+	AlexaCategory string   `json:"alexa_category,omitempty"` // defaults to first member's
+}
+
+// room or floor. areas are addressable like devices: commands are sent to the area's (and its
+// sub-areas') devices that support the command
+type AreaConfig struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Parent        string `json:"parent,omitempty"`         // f.ex. kitchen's parent is groundFloor
+	AlexaCategory string `json:"alexa_category,omitempty"` // empty = hide from Alexa
 }
 
 type Person struct {
-	Id string `json:"id"`
+	Id               string `json:"id"`
+	AwayDelaySeconds int    `json:"away_delay_seconds,omitempty"` // all sources have to say away for this long
 }
 
 type ActionConfig struct {
-	Device          string `json:"device"`
-	Verb            string `json:"verb"`             // powerOn/powerOff/powerToggle/blink/ir/setBooleanFalse/setBooleanTrue/sleep/playback/notify
-	IrCommand       string `json:"ir_command"`       // used by: ir
-	Boolean         string `json:"boolean"`          // used by: setBooleanTrue/setBooleanFalse
-	DurationSeconds int    `json:"duration_seconds"` // used by: sleep
-	PlaybackAction  string `json:"playback_action"`  // used by: playback
-	NotifyMessage   string `json:"notify_message"`   // used by: notify
+	Device           string  `json:"device"`
+	Area             string  `json:"area"`              // instead of device: all devices in area that support the verb
+	Capability       string  `json:"capability"`        // used with area: narrows down devices, f.ex. "brightness" for (dimmable) lights
+	Verb             string  `json:"verb"`              // powerOn/powerOff/powerToggle/blink/ir/setBooleanFalse/setBooleanTrue/sleep/playback/notify/scene/brightness/color/colorTemperature/cancel/setVariable/incrementVariable/decrementVariable/cycleVariable
+	IrCommand        string  `json:"ir_command"`        // used by: ir
+	Boolean          string  `json:"boolean"`           // used by: setBooleanTrue/setBooleanFalse
+	DurationSeconds  int     `json:"duration_seconds"`  // used by: sleep
+	PlaybackAction   string  `json:"playback_action"`   // used by: playback
+	NotifyMessage    string  `json:"notify_message"`    // used by: notify
+	Scene            string  `json:"scene"`             // used by: scene
+	Sequence         string  `json:"sequence"`          // used by: cancel
+	Brightness       uint    `json:"brightness"`        // used by: brightness. 0-100 %
+	Color            string  `json:"color"`             // used by: color. "#ff8800" or named color like "orange"
+	ColorTemperature uint    `json:"color_temperature"` // used by: colorTemperature. [Kelvin]
+	Variable         string  `json:"variable"`          // used by: *Variable
+	Value            string  `json:"value"`             // used by: setVariable
+	Amount           float64 `json:"amount"`            // used by: incrementVariable/decrementVariable. defaults to 1
 }
 
 type ConditionConfig struct {
-	Type            string `json:"type"` // boolean-is-true/boolean-is-false/boolean-not-changed-within
-	Boolean         string `json:"boolean"`
-	DurationSeconds int    `json:"duration_seconds"`
+	Type            string            `json:"type"`                // boolean-is-true/boolean-is-false/boolean-not-changed-within/time-between/weekday-is/sun-is-up/sun-is-down/device-is-on/device-is-off/sensor-threshold/person-is-present/person-is-away/variable-is/variable-threshold/variable-not-changed-within/any/all/not
+	Boolean         string            `json:"boolean"`             // used by: boolean-is-true/boolean-is-false/boolean-not-changed-within
+	DurationSeconds int               `json:"duration_seconds"`    // used by: boolean-not-changed-within/variable-not-changed-within
+	After           string            `json:"after,omitempty"`     // used by: time-between. "22:00" or sun event like "sunset-30m"
+	Before          string            `json:"before,omitempty"`    // used by: time-between. "06:00" or sun event like "sunrise"
+	Weekdays        []string          `json:"weekdays,omitempty"`  // used by: weekday-is. "mon", "tue", ..
+	Device          string            `json:"device,omitempty"`    // used by: device-is-on/device-is-off/sensor-threshold
+	Attribute       string            `json:"attribute,omitempty"` // used by: sensor-threshold. temperature | humidity | pressure
+	Above           *float64          `json:"above,omitempty"`     // used by: sensor-threshold/variable-threshold
+	Below           *float64          `json:"below,omitempty"`     // used by: sensor-threshold/variable-threshold
+	Person          string            `json:"person,omitempty"`    // used by: person-is-present/person-is-away
+	Variable        string            `json:"variable,omitempty"`  // used by: variable-*
+	Value           string            `json:"value,omitempty"`     // used by: variable-is
+	Conditions      []ConditionConfig `json:"condition,omitempty"` // used by: any/all/not
 }
 
 type SubscribeConfig struct {
-	Event      string            `json:"event"`
+	Event      string            `json:"event"` // exact topic, or pattern where "*" or "+" matches any segment
 	Actions    []ActionConfig    `json:"action"`
 	Conditions []ConditionConfig `json:"condition"`
+	Sequence   string            `json:"sequence,omitempty"` // name, so runs can be restarted/cancelled. see Mode
+	Mode       string            `json:"mode,omitempty"`     // parallel (default) | restart | ignore | queue
+}
+
+// occupancy-based lighting: lights are turned on by motion and turned off when no motion
+// has been seen within the timeout
+type PolicyConfig struct {
+	Id                    string   `json:"id"`
+	Lights                []string `json:"lights"`
+	MotionSensors         []string `json:"motion_sensors"`
+	EgressContact         string   `json:"egress_contact,omitempty"` // door closed + motion after that = someone's still inside
+	OnTimeoutSeconds      int      `json:"on_timeout_seconds"`
+	ManualOverrideSeconds int      `json:"manual_override_seconds"` // policy backs off this long after explicit power event
+	RequireDarkness       bool     `json:"require_darkness"`        // stays off if environmentHasLight
+	RequireAnybodyHome    bool     `json:"require_anybody_home"`
+}
+
+// user-defined boolean, settable with setBooleanTrue/setBooleanFalse. value survives restarts
+type BooleanConfig struct {
+	Id      string `json:"id"`
+	Initial bool   `json:"initial"` // used if there's no persisted value
+}
+
+// typed variable. changes publish "var:<id>:changes-to:<value>". value survives restarts
+type VariableConfig struct {
+	Id      string   `json:"id"`
+	Type    string   `json:"type"`              // counter | number | enum
+	Initial string   `json:"initial,omitempty"` // used if there's no persisted value. defaults to 0 or first enum value
+	Values  []string `json:"values,omitempty"`  // enum's allowed values, in cycling order
+	Min     *float64 `json:"min,omitempty"`     // numbers are clamped. counter's min defaults to 0
+	Max     *float64 `json:"max,omitempty"`
+}
+
+// publishes "held:<id>" once device's state has held for the duration. fires once per
+// episode: the state has to change (and come back) before it fires again.
+type HeldStateConfig struct {
+	Id              string `json:"id"`
+	Device          string `json:"device"`
+	State           string `json:"state"` // contact-open | contact-closed | no-motion | waterleak | offline
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+// dependents (f.ex. TV & media PC) need the device (f.ex. amplifier) powered on. first dependent
+// turning on powers the device on, and the last one turning off powers it off after a grace period
+type PowerDependencyConfig struct {
+	Device          string   `json:"device"`
+	Dependents      []string `json:"dependents"`
+	OnDelaySeconds  int      `json:"on_delay_seconds,omitempty"` // dependents are powered on this long after the device
+	OffGraceSeconds int      `json:"off_grace_seconds,omitempty"`
+}
+
+// named set of device states that can be activated at once
+type SceneConfig struct {
+	Id      string              `json:"id"`
+	Name    string              `json:"name"`
+	Alexa   bool                `json:"alexa,omitempty"` // expose as Alexa scene
+	Devices []SceneDeviceConfig `json:"device"`
+}
+
+// zero values leave that aspect of the device as is
+type SceneDeviceConfig struct {
+	Device           string `json:"device"`
+	Power            string `json:"power,omitempty"`             // on | off
+	Brightness       uint   `json:"brightness,omitempty"`        // 1-100 %
+	Color            string `json:"color,omitempty"`             // "#ff8800" or named color like "orange"
+	ColorTemperature uint   `json:"color_temperature,omitempty"` // [Kelvin]
 }
 
 type ConfigFile struct {
-	Adapters      []AdapterConfig     `json:"adapter"`
-	Devices       []DeviceConfig      `json:"device"`
-	DeviceGroups  []DeviceGroupConfig `json:"devicegroup"`
-	Persons       []Person            `json:"person"`
-	Subscriptions []SubscribeConfig   `json:"subscribe"`
+	Adapters          []AdapterConfig         `json:"adapter"`
+	Devices           []DeviceConfig          `json:"device"`
+	DeviceGroups      []DeviceGroupConfig     `json:"devicegroup"`
+	Areas             []AreaConfig            `json:"area"`
+	Persons           []Person                `json:"person"`
+	Subscriptions     []SubscribeConfig       `json:"subscribe"`
+	Policies          []PolicyConfig          `json:"policy"`
+	Scenes            []SceneConfig           `json:"scene"`
+	HeldStates        []HeldStateConfig       `json:"held"`
+	Booleans          []BooleanConfig         `json:"boolean"`
+	Variables         []VariableConfig        `json:"variable"`
+	PowerDependencies []PowerDependencyConfig `json:"power_dependency"`
 }
 
 func (c *ConfigFile) FindDeviceConfigByAdaptersDeviceId(adaptersDeviceId string) *DeviceConfig {
@@ -5,13 +5,18 @@ import (
 )
 
 type ContactEvent struct {
+	InboundMeta
 	Device  string
 	Contact bool
-	When    time.Time
 }
 
 func NewContactEvent(deviceId string, contact bool, now time.Time) *ContactEvent {
-	return &ContactEvent{deviceId, contact, now}
+	e := &ContactEvent{
+		Device:  deviceId,
+		Contact: contact,
+	}
+	e.When = now
+	return e
 }
 
 func (e *ContactEvent) InboundEventType() string {
@@ -0,0 +1,101 @@
+package hapitypes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// device type of devices generated for device groups
+const DeviceGroupType = "devicegroup"
+
+func (c *ConfigFile) FindDeviceGroup(id string) *DeviceGroupConfig {
+	for _, group := range c.DeviceGroups {
+		if group.DeviceId == id {
+			return &group
+		}
+	}
+
+	return nil
+}
+
+// for device groups it's the intersection of the members' (which can be groups themselves)
+// capabilities. returns error on unknown members or cyclic groups
+func ResolveCapabilities(deviceId string, conf *ConfigFile) (Capabilities, error) {
+	return resolveCapabilities(deviceId, conf, []string{})
+}
+
+func resolveCapabilities(deviceId string, conf *ConfigFile, path []string) (Capabilities, error) {
+	for _, visiting := range path {
+		if visiting == deviceId {
+			return Capabilities{}, fmt.Errorf(
+				"device group cycle: %s",
+				strings.Join(append(path, deviceId), " -> "))
+		}
+	}
+
+	group := conf.FindDeviceGroup(deviceId)
+	if group == nil {
+		deviceConf := findDeviceConfig(deviceId, conf)
+		if deviceConf == nil {
+			return Capabilities{}, fmt.Errorf("device %s not found", deviceId)
+		}
+
+		deviceType, err := ResolveDeviceType(deviceConf.Type)
+		if err != nil {
+			return Capabilities{}, err
+		}
+
+		return deviceType.Capabilities, nil
+	}
+
+	if len(group.Devices) == 0 {
+		return Capabilities{}, fmt.Errorf("device group %s has no devices", deviceId)
+	}
+
+	var intersection *Capabilities
+
+	for _, member := range group.Devices {
+		memberCaps, err := resolveCapabilities(member, conf, append(path, deviceId))
+		if err != nil {
+			return Capabilities{}, err
+		}
+
+		if intersection == nil {
+			intersection = &memberCaps
+		} else {
+			*intersection = intersection.Intersect(memberCaps)
+		}
+	}
+
+	return *intersection, nil
+}
+
+// group's own category, or its first member's (recursively for nested groups)
+func ResolveGroupAlexaCategory(group DeviceGroupConfig, conf *ConfigFile) string {
+	if group.AlexaCategory != "" || len(group.Devices) == 0 {
+		return group.AlexaCategory
+	}
+
+	first := group.Devices[0]
+
+	// ResolveCapabilities() has already checked for cycles
+	if memberGroup := conf.FindDeviceGroup(first); memberGroup != nil {
+		return ResolveGroupAlexaCategory(*memberGroup, conf)
+	}
+
+	if deviceConf := findDeviceConfig(first, conf); deviceConf != nil {
+		return deviceConf.AlexaCategory
+	}
+
+	return ""
+}
+
+func findDeviceConfig(deviceId string, conf *ConfigFile) *DeviceConfig {
+	for _, deviceConf := range conf.Devices {
+		if deviceConf.DeviceId == deviceId {
+			return &deviceConf
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package hapitypes
+
+import (
+	"github.com/function61/gokit/assert"
+	"testing"
+)
+
+func TestResolveCapabilities(t *testing.T) {
+	conf := &ConfigFile{
+		Devices: []DeviceConfig{
+			{DeviceId: "rgb", Type: "ikea-trådfri-rgb", AlexaCategory: "LIGHT"},
+			{DeviceId: "noncolored", Type: "ikea-trådfri-noncolored"},
+			{DeviceId: "plug", Type: "ikea-trådfri-smartplug", AlexaCategory: "SMARTPLUG"},
+		},
+		DeviceGroups: []DeviceGroupConfig{
+			{DeviceId: "lights", Devices: []string{"rgb", "noncolored"}},
+			{DeviceId: "everything", Devices: []string{"lights", "plug"}},
+			{DeviceId: "plugs", Devices: []string{"plug"}, AlexaCategory: "LIGHT"},
+			{DeviceId: "a", Devices: []string{"rgb", "b"}},
+			{DeviceId: "b", Devices: []string{"a"}},
+			{DeviceId: "stale", Devices: []string{"rgb", "removed"}},
+		},
+	}
+
+	caps, err := ResolveCapabilities("lights", conf)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, caps == Capabilities{
+		Power:            true,
+		Brightness:       true,
+		ColorTemperature: true,
+	})
+
+	caps, err = ResolveCapabilities("everything", conf)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, caps == Capabilities{Power: true})
+
+	_, err = ResolveCapabilities("a", conf)
+	assert.EqualString(t, err.Error(), "device group cycle: a -> b -> a")
+
+	_, err = ResolveCapabilities("stale", conf)
+	assert.EqualString(t, err.Error(), "device removed not found")
+
+	assert.EqualString(t, ResolveGroupAlexaCategory(*conf.FindDeviceGroup("everything"), conf), "LIGHT")
+	assert.EqualString(t, ResolveGroupAlexaCategory(*conf.FindDeviceGroup("plugs"), conf), "LIGHT")
+}
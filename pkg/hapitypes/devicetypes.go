@@ -131,6 +131,11 @@ var deviceTypes = map[string]*DeviceType{
 		Model:        "WXKG02LM",
 		BatteryType:  "CR2032",
 	},
+	DeviceGroupType: &DeviceType{ // capabilities are resolved from members, see ResolveCapabilities()
+		Name:         "Device group",
+		Manufacturer: "Hautomo",
+		Model:        "Device group",
+	},
 	"eventghostClient": &DeviceType{
 		Name:         "EventGhost client",
 		Manufacturer: "EventGhost",
@@ -168,3 +173,29 @@ type Capabilities struct {
 	Playback                  bool `json:"playback"`
 	ReportsTemperature        bool `json:"reports_temperature"`
 }
+
+// capabilities that either has
+func (c Capabilities) Union(other Capabilities) Capabilities {
+	return Capabilities{
+		Power:                     c.Power || other.Power,
+		Brightness:                c.Brightness || other.Brightness,
+		Color:                     c.Color || other.Color,
+		ColorTemperature:          c.ColorTemperature || other.ColorTemperature,
+		ColorSeparateWhiteChannel: c.ColorSeparateWhiteChannel || other.ColorSeparateWhiteChannel,
+		Playback:                  c.Playback || other.Playback,
+		ReportsTemperature:        c.ReportsTemperature || other.ReportsTemperature,
+	}
+}
+
+// capabilities that both have
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	return Capabilities{
+		Power:                     c.Power && other.Power,
+		Brightness:                c.Brightness && other.Brightness,
+		Color:                     c.Color && other.Color,
+		ColorTemperature:          c.ColorTemperature && other.ColorTemperature,
+		ColorSeparateWhiteChannel: c.ColorSeparateWhiteChannel && other.ColorSeparateWhiteChannel,
+		Playback:                  c.Playback && other.Playback,
+		ReportsTemperature:        c.ReportsTemperature && other.ReportsTemperature,
+	}
+}
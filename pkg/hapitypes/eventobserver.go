@@ -0,0 +1,8 @@
+package hapitypes
+
+// gets a copy of every event flowing through the adapters, f.ex. for journaling.
+// implementations must be safe for concurrent use, as adapters call these from their own goroutines.
+type EventObserver interface {
+	ObserveInbound(e InboundEvent) // source is in e.Meta()
+	ObserveOutbound(adapterId string, e OutboundEvent)
+}
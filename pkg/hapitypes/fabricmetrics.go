@@ -0,0 +1,81 @@
+package hapitypes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+// queue depths are read at collection time, drops are counted as they happen
+type FabricMetrics struct {
+	inboundDepthDesc  *prometheus.Desc
+	outboundDepthDesc *prometheus.Desc
+	inboundFull       prometheus.Counter
+	outboundDropped   *prometheus.CounterVec
+	commandFailures   *prometheus.CounterVec
+	fabric            *InboundFabric
+	adapters          []*Adapter
+	adaptersMu        sync.Mutex
+}
+
+func newFabricMetrics(fabric *InboundFabric) *FabricMetrics {
+	return &FabricMetrics{
+		inboundDepthDesc: prometheus.NewDesc(
+			"hautomo_inbound_queue_depth",
+			"Inbound events waiting to be processed by the hub",
+			nil,
+			nil),
+		outboundDepthDesc: prometheus.NewDesc(
+			"hautomo_outbound_queue_depth",
+			"Outbound events waiting to be processed by an adapter",
+			[]string{"adapter"},
+			nil),
+		inboundFull: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hautomo_inbound_queue_full_total",
+			Help: "Times an adapter had to wait because inbound queue was full",
+		}),
+		outboundDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hautomo_outbound_queue_dropped_total",
+			Help: "Outbound events dropped due to adapter's queue being full",
+		}, []string{"adapter", "reason"}),
+		commandFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hautomo_command_failures_total",
+			Help: "Outbound commands that adapters reported as failed",
+		}, []string{"device"}),
+		fabric:   fabric,
+		adapters: []*Adapter{},
+	}
+}
+
+func (f *FabricMetrics) registerAdapter(adapter *Adapter) {
+	f.adaptersMu.Lock()
+	defer f.adaptersMu.Unlock()
+
+	f.adapters = append(f.adapters, adapter)
+}
+
+// contract of prometheus.Collector
+func (f *FabricMetrics) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// contract of prometheus.Collector
+func (f *FabricMetrics) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(
+		f.inboundDepthDesc,
+		prometheus.GaugeValue,
+		float64(len(f.fabric.Ch)))
+
+	f.adaptersMu.Lock()
+	for _, adapter := range f.adapters {
+		ch <- prometheus.MustNewConstMetric(
+			f.outboundDepthDesc,
+			prometheus.GaugeValue,
+			float64(len(adapter.Outbound)),
+			adapter.Conf.Id)
+	}
+	f.adaptersMu.Unlock()
+
+	f.inboundFull.Collect(ch)
+	f.outboundDropped.Collect(ch)
+	f.commandFailures.Collect(ch)
+}
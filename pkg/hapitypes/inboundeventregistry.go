@@ -0,0 +1,46 @@
+package hapitypes
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// for reconstructing serialized inbound events (f.ex. from event journal). keyed by InboundEventType()
+var inboundEventTypes = map[string]func() InboundEvent{
+	"BatteryStatusEvent":               func() InboundEvent { return &BatteryStatusEvent{} },
+	"BlinkEvent":                       func() InboundEvent { return &BlinkEvent{} },
+	"BrightnessEvent":                  func() InboundEvent { return &BrightnessEvent{} },
+	"ColorMsg":                         func() InboundEvent { return &ColorMsg{} },
+	"ColorTemperatureEvent":            func() InboundEvent { return &ColorTemperatureEvent{} },
+	"ContactEvent":                     func() InboundEvent { return &ContactEvent{} },
+	"InfraredEvent":                    func() InboundEvent { return &InfraredEvent{} },
+	"LinkQualityEvent":                 func() InboundEvent { return &LinkQualityEvent{} },
+	"MotionEvent":                      func() InboundEvent { return &MotionEvent{} },
+	"NotificationEvent":                func() InboundEvent { return &NotificationEvent{} },
+	"PersonPresenceChangeEvent":        func() InboundEvent { return &PersonPresenceChangeEvent{} },
+	"PlaybackEvent":                    func() InboundEvent { return &PlaybackEvent{} },
+	"PowerEvent":                       func() InboundEvent { return &PowerEvent{} },
+	"PowerReportEvent":                 func() InboundEvent { return &PowerReportEvent{} },
+	"PublishEvent":                     func() InboundEvent { return &PublishEvent{} },
+	"PushButtonEvent":                  func() InboundEvent { return &PushButtonEvent{} },
+	"RawInfraredEvent":                 func() InboundEvent { return &RawInfraredEvent{} },
+	"SceneActivationEvent":             func() InboundEvent { return &SceneActivationEvent{} },
+	"SceneCaptureEvent":                func() InboundEvent { return &SceneCaptureEvent{} },
+	"TemperatureHumidityPressureEvent": func() InboundEvent { return &TemperatureHumidityPressureEvent{} },
+	"VibrationEvent":                   func() InboundEvent { return &VibrationEvent{} },
+	"WaterLeakEvent":                   func() InboundEvent { return &WaterLeakEvent{} },
+}
+
+func UnmarshalInboundEvent(eventType string, data []byte) (InboundEvent, error) {
+	allocate, found := inboundEventTypes[eventType]
+	if !found {
+		return nil, fmt.Errorf("unknown inbound event type: %s", eventType)
+	}
+
+	e := allocate()
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("%s: %v", eventType, err)
+	}
+
+	return e, nil
+}
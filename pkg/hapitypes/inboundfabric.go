@@ -1,16 +1,58 @@
 package hapitypes
 
+import (
+	"github.com/function61/gokit/logex"
+	"time"
+)
+
+// source used for inbound events generated by the hub itself (f.ex. subscription actions)
+const InboundSourceHub = "hub"
+
 type InboundFabric struct {
-	Ch chan InboundEvent
+	Ch       chan InboundEvent
+	Observer EventObserver    // optional
+	Now      func() time.Time // for stamping events that don't carry origin timestamp
+	Metrics  *FabricMetrics
+	Results  *CommandResults
+	logl     *logex.Leveled
 }
 
-func NewInboundFabric() *InboundFabric {
-	return &InboundFabric{
-		Ch: make(chan InboundEvent, 32),
+func NewInboundFabric(logl *logex.Leveled) *InboundFabric {
+	fabric := &InboundFabric{
+		Ch:   make(chan InboundEvent, 32),
+		Now:  time.Now,
+		logl: logl,
 	}
+
+	fabric.Metrics = newFabricMetrics(fabric)
+	fabric.Results = newCommandResults(fabric.Metrics)
+
+	return fabric
 }
 
 func (f *InboundFabric) Receive(e InboundEvent) {
-	// TODO: log if channel full?
-	f.Ch <- e
+	f.ReceiveFrom(InboundSourceHub, e)
+}
+
+func (f *InboundFabric) ReceiveFrom(source string, e InboundEvent) {
+	meta := e.Meta()
+	if meta.When.IsZero() { // adapter may have set a more accurate timestamp
+		meta.When = f.Now()
+	}
+	meta.Source = source
+
+	if f.Observer != nil {
+		f.Observer.ObserveInbound(e)
+	}
+
+	select {
+	case f.Ch <- e:
+	default:
+		// inbound events are not dropped (we'd lose state changes), but we want to know
+		// when adapters have to wait for the hub
+		f.logl.Error.Printf("inbound queue full; %s from %s waits", e.InboundEventType(), source)
+		f.Metrics.inboundFull.Inc()
+
+		f.Ch <- e
+	}
 }
@@ -0,0 +1,20 @@
+package hapitypes
+
+import (
+	"time"
+)
+
+// embedded in all inbound events. stamped when the event enters the hub (see InboundFabric).
+// not serialized as part of the event, because event journal records these separately.
+type InboundMeta struct {
+	When   time.Time `json:"-"` // origin timestamp, f.ex. when the sensor reported it
+	Source string    `json:"-"` // adapter id, or InboundSourceHub
+
+	// set by originator (f.ex. HTTP API) if it wants to know the outcome of resulting
+	// outbound commands. see CommandResults
+	CorrelationId string `json:"-"`
+}
+
+func (m *InboundMeta) Meta() *InboundMeta {
+	return m
+}
@@ -1,6 +1,7 @@
 package hapitypes
 
 type RawInfraredEvent struct {
+	InboundMeta
 	Remote string
 	Event  string
 }
@@ -17,6 +18,8 @@ func (e *RawInfraredEvent) InboundEventType() string {
 }
 
 type InfraredEvent struct {
+	InboundMeta
+	OutboundMeta
 	Device  string
 	Command string
 }
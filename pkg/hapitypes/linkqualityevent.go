@@ -1,6 +1,7 @@
 package hapitypes
 
 type LinkQualityEvent struct {
+	InboundMeta
 	Device      string
 	LinkQuality uint // 0-100 %
 }
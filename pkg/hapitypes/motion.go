@@ -1,6 +1,7 @@
 package hapitypes
 
 type MotionEvent struct {
+	InboundMeta
 	Device      string
 	Movement    bool
 	Illuminance uint
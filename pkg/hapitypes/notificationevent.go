@@ -1,12 +1,29 @@
 package hapitypes
 
 type NotificationEvent struct {
+	InboundMeta
+	OutboundMeta
 	Device  string
 	Message string
+	// non-empty if Message is a template, which the hub renders when it handles the event
+	// (device state can only be read consistently there)
+	TemplateTrigger string
 }
 
 func NewNotificationEvent(device string, message string) *NotificationEvent {
-	return &NotificationEvent{device, message}
+	return &NotificationEvent{
+		Device:  device,
+		Message: message,
+	}
+}
+
+// trigger is the topic that the template sees as .Event
+func NewNotificationTemplateEvent(device string, template string, trigger string) *NotificationEvent {
+	return &NotificationEvent{
+		Device:          device,
+		Message:         template,
+		TemplateTrigger: trigger,
+	}
 }
 
 func (e *NotificationEvent) InboundEventType() string {
@@ -0,0 +1,19 @@
+package hapitypes
+
+// embedded in all outbound events. filled by the hub when sending, so adapter's result report
+// can be routed back to whoever originated the command
+type OutboundMeta struct {
+	CorrelationId string `json:"-"` // copied from originating inbound event (if any)
+	Device        string `json:"-"` // hub's device id (event itself carries adapter's device id)
+}
+
+func (m *OutboundMeta) OutMeta() *OutboundMeta {
+	return m
+}
+
+// like RedirectInbound(), but member devices' results get routed to the group command's originator
+func RedirectInboundCorrelated(e OutboundEvent, toDeviceId string) InboundEvent {
+	redirected := e.RedirectInbound(toDeviceId)
+	redirected.Meta().CorrelationId = e.OutMeta().CorrelationId
+	return redirected
+}
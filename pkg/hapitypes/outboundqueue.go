@@ -0,0 +1,103 @@
+package hapitypes
+
+import (
+	"errors"
+	"fmt"
+)
+
+const defaultOutboundQueueSize = 32
+
+type OverflowPolicy string
+
+// what to do when adapter's outbound queue is full
+const (
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	OverflowCoalesce   OverflowPolicy = "coalesce" // newer state for same device supersedes older. falls back to drop-oldest
+)
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch OverflowPolicy(policy) {
+	case "":
+		return OverflowCoalesce, nil
+	case OverflowDropOldest, OverflowDropNewest, OverflowCoalesce:
+		return OverflowPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unknown outbound overflow policy: %s", policy)
+	}
+}
+
+// outbound events that set state (as opposed to actions, like IR commands), so a newer
+// one with the same key supersedes an older one
+type CoalescableEvent interface {
+	CoalesceKey() string
+}
+
+// must be called with sendMu held. we are the only producer, so consumer can only make more room
+func (a *Adapter) overflow(e OutboundEvent) {
+	if a.overflowPolicy == OverflowDropNewest {
+		a.dropped(e, OverflowDropNewest)
+		return
+	}
+
+	if a.overflowPolicy == OverflowCoalesce && a.coalesce(e) {
+		return
+	}
+
+	select {
+	case oldest := <-a.Outbound:
+		a.dropped(oldest, OverflowDropOldest)
+	default: // consumer made room in the meantime
+	}
+
+	a.Outbound <- e
+}
+
+// removes queued event with the same coalesce key, and appends the new one at the end
+func (a *Adapter) coalesce(e OutboundEvent) bool {
+	coalescable, ok := e.(CoalescableEvent)
+	if !ok {
+		return false
+	}
+
+	queued := []OutboundEvent{}
+	for len(a.Outbound) > 0 {
+		select {
+		case q := <-a.Outbound:
+			queued = append(queued, q)
+		default: // consumer took the last one
+		}
+	}
+
+	superseded := -1
+	for i := len(queued) - 1; i >= 0; i-- {
+		if q, ok := queued[i].(CoalescableEvent); ok && q.CoalesceKey() == coalescable.CoalesceKey() {
+			superseded = i
+			break
+		}
+	}
+
+	if superseded != -1 {
+		a.dropped(queued[superseded], OverflowCoalesce)
+		queued = append(append(queued[:superseded], queued[superseded+1:]...), e)
+	}
+
+	for _, q := range queued {
+		a.Outbound <- q
+	}
+
+	return superseded != -1
+}
+
+func (a *Adapter) dropped(e OutboundEvent, reason OverflowPolicy) {
+	a.Logl.Error.Printf("outbound queue full; dropped %s (%s)", e.OutboundEventType(), reason)
+
+	a.inbound.Metrics.outboundDropped.WithLabelValues(a.Conf.Id, string(reason)).Inc()
+
+	if reason == OverflowCoalesce {
+		// not a device failure (newer command reports for itself), but originator must know
+		a.inbound.Results.deliver(a.result(e, errors.New("superseded by a newer command")))
+	} else {
+		a.Report(e, fmt.Errorf("dropped: outbound queue full (%s)", reason))
+	}
+}
@@ -0,0 +1,51 @@
+package hapitypes
+
+import (
+	"github.com/function61/gokit/assert"
+	"github.com/function61/gokit/logex"
+	"strings"
+	"testing"
+)
+
+func TestOutboundOverflow(t *testing.T) {
+	queued := func(overflow string, events ...OutboundEvent) string {
+		adapter, err := NewAdapter(AdapterConfig{
+			Id:                "test",
+			OutboundQueueSize: 2,
+			OutboundOverflow:  overflow,
+		}, nil, NewInboundFabric(logex.Levels(logex.Discard)), nil, logex.Discard)
+		assert.Assert(t, err == nil)
+
+		for _, e := range events {
+			adapter.Send(e)
+		}
+
+		descriptions := []string{}
+		for len(adapter.Outbound) > 0 {
+			switch e := (<-adapter.Outbound).(type) {
+			case *PowerMsg:
+				descriptions = append(descriptions, e.DeviceId+"="+e.PowerCommand)
+			case *PlaybackEvent:
+				descriptions = append(descriptions, e.Device+"="+e.Action)
+			}
+		}
+
+		return strings.Join(descriptions, " ")
+	}
+
+	a1 := NewPowerMsg("a", "1", true)
+	b1 := NewPowerMsg("b", "1", true)
+	a2 := NewPowerMsg("a", "2", false)
+	c1 := NewPowerMsg("c", "1", true)
+	play := NewPlaybackEvent("tv", "pause")
+
+	assert.EqualString(t, queued("drop-oldest", a1, b1, c1), "b=1 c=1")
+	assert.EqualString(t, queued("drop-newest", a1, b1, c1), "a=1 b=1")
+	assert.EqualString(t, queued("", a1, b1, a2), "b=1 a=2")
+	// nothing to coalesce with => falls back to drop-oldest
+	assert.EqualString(t, queued("coalesce", a1, b1, c1), "b=1 c=1")
+	assert.EqualString(t, queued("coalesce", a1, b1, play), "b=1 tv=pause")
+
+	_, err := NewAdapter(AdapterConfig{Id: "test", OutboundOverflow: "yolo"}, nil, NewInboundFabric(logex.Levels(logex.Discard)), nil, logex.Discard)
+	assert.EqualString(t, err.Error(), "adapter test: unknown outbound overflow policy: yolo")
+}
@@ -8,8 +8,10 @@ func NewPersonPresenceChangeEvent(personId string, present bool) *PersonPresence
 }
 
 type PersonPresenceChangeEvent struct {
+	InboundMeta
 	PersonId string
 	Present  bool
+	Via      string `json:",omitempty"` // distinguishes sources within an adapter, f.ex. pinged device's IP
 }
 
 func (e *PersonPresenceChangeEvent) InboundEventType() string {
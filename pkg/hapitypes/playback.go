@@ -1,6 +1,8 @@
 package hapitypes
 
 type PlaybackEvent struct {
+	InboundMeta
+	OutboundMeta
 	Device string
 	Action string
 }
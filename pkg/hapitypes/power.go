@@ -9,6 +9,7 @@ const (
 )
 
 type PowerEvent struct {
+	InboundMeta
 	DeviceIdOrDeviceGroupId string
 	Kind                    PowerKind
 	// whether this was explicitly asked by the user, or generated (f.ex. by a device
@@ -36,10 +37,31 @@ func NewPowerToggleEvent(deviceIdOrDeviceGroupId string, explicit bool) PowerEve
 	}
 }
 
+// device reporting its actual power state (as opposed to us commanding it)
+type PowerReportEvent struct {
+	InboundMeta
+	Device string
+	On     bool
+}
+
+func NewPowerReportEvent(deviceId string, on bool) *PowerReportEvent {
+	return &PowerReportEvent{
+		Device: deviceId,
+		On:     on,
+	}
+}
+
+func (e *PowerReportEvent) InboundEventType() string {
+	return "PowerReportEvent"
+}
+
 type PowerMsg struct {
+	OutboundMeta
 	DeviceId     string
 	PowerCommand string
 	On           bool
+	// see PowerEvent. carried over to device group's members
+	Explicit bool `json:",omitempty"`
 }
 
 func NewPowerMsg(deviceId string, powerCommand string, on bool) *PowerMsg {
@@ -54,10 +76,15 @@ func (e *PowerMsg) OutboundEventType() string {
 	return "PowerMsg"
 }
 
-// used by device group adapter, therefore we can mark these as implicit
+// used by device group adapter. members' events are as explicit as the group's was, so
+// explicit group commands bypass members' limits
 func (e *PowerMsg) RedirectInbound(toDeviceId string) InboundEvent {
 	if e.On {
-		return NewPowerEvent(toDeviceId, PowerKindOn, false)
+		return NewPowerEvent(toDeviceId, PowerKindOn, e.Explicit)
 	}
-	return NewPowerEvent(toDeviceId, PowerKindOff, false)
+	return NewPowerEvent(toDeviceId, PowerKindOff, e.Explicit)
+}
+
+func (e *PowerMsg) CoalesceKey() string {
+	return e.OutboundEventType() + ":" + e.DeviceId
 }
@@ -1,11 +1,12 @@
 package hapitypes
 
 type PublishEvent struct {
+	InboundMeta
 	Topic string
 }
 
 func NewPublishEvent(topic string) *PublishEvent {
-	return &PublishEvent{topic}
+	return &PublishEvent{Topic: topic}
 }
 
 func (e *PublishEvent) InboundEventType() string {
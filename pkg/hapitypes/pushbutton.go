@@ -1,6 +1,7 @@
 package hapitypes
 
 type PushButtonEvent struct {
+	InboundMeta
 	Device    string
 	Specifier string // single/double/...
 }
@@ -0,0 +1,34 @@
+package hapitypes
+
+type SceneActivationEvent struct {
+	InboundMeta
+	SceneId string
+}
+
+func NewSceneActivationEvent(sceneId string) *SceneActivationEvent {
+	return &SceneActivationEvent{SceneId: sceneId}
+}
+
+func (e *SceneActivationEvent) InboundEventType() string {
+	return "SceneActivationEvent"
+}
+
+// stores devices' current state as a scene (replacing previously captured scene with same id)
+type SceneCaptureEvent struct {
+	InboundMeta
+	SceneId string
+	Name    string
+	Devices []string
+}
+
+func NewSceneCaptureEvent(sceneId string, name string, devices []string) *SceneCaptureEvent {
+	return &SceneCaptureEvent{
+		SceneId: sceneId,
+		Name:    name,
+		Devices: devices,
+	}
+}
+
+func (e *SceneCaptureEvent) InboundEventType() string {
+	return "SceneCaptureEvent"
+}
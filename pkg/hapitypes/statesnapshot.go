@@ -6,11 +6,42 @@ import (
 
 type Statefile struct {
 	Devices map[string]DeviceStateSnapshot `json:"device_state_snapshots_by_id"`
+	Scenes  []SceneConfig                  `json:"captured_scenes"`
+	// keyed by schedule event, like "cron:0 7 * * 1-5"
+	SchedulesLastFired map[string]time.Time `json:"schedules_last_fired"`
+	// config-declared booleans keyed by id
+	Booleans  map[string]BooleanSnapshot  `json:"booleans"`
+	Variables map[string]VariableSnapshot `json:"variables"`
+	Persons   map[string]PersonSnapshot   `json:"persons"`
+	// start of the episode each held state already fired for, keyed by held state id
+	HeldStatesFiredFor map[string]time.Time `json:"held_states_fired_for"`
+}
+
+type PersonSnapshot struct {
+	Present    bool      `json:"present"`
+	LastChange time.Time `json:"last_change"`
+}
+
+type VariableSnapshot struct {
+	Value      string    `json:"value"`
+	LastChange time.Time `json:"last_change"`
+}
+
+type BooleanSnapshot struct {
+	Value      bool      `json:"value"`
+	LastChange time.Time `json:"last_change"`
 }
 
 func NewStatefile() Statefile {
 	return Statefile{
 		Devices: map[string]DeviceStateSnapshot{},
+		Scenes:  []SceneConfig{},
+
+		SchedulesLastFired: map[string]time.Time{},
+		Booleans:           map[string]BooleanSnapshot{},
+		Variables:          map[string]VariableSnapshot{},
+		Persons:            map[string]PersonSnapshot{},
+		HeldStatesFiredFor: map[string]time.Time{},
 	}
 }
 
@@ -19,33 +50,65 @@ func NewStatefile() Statefile {
 type DeviceStateSnapshot struct {
 	ProbablyTurnedOn                     bool                              `json:"probably_turned_on"`
 	LastColor                            RGB                               `json:"last_color"`
+	LastBrightness                       uint                              `json:"last_brightness,omitempty"`
+	LastColorTemperature                 uint                              `json:"last_color_temperature,omitempty"`
 	LastTemperatureHumidityPressureEvent *TemperatureHumidityPressureEvent `json:"last_temperaturehumiditypressure"`
 	LastOnline                           *time.Time                        `json:"last_online"`
 	LinkQuality                          uint                              `json:"link_quality_pct"`
 	BatteryPct                           uint                              `json:"battery_pct"`
 	BatteryVoltage                       uint                              `json:"battery_voltage_mv"`
+
+	// so held states (door left open, water leak) survive restarts
+	Contact        *bool      `json:"contact,omitempty"`
+	LastContactAt  *time.Time `json:"last_contact_at,omitempty"`
+	ContactSince   *time.Time `json:"contact_since,omitempty"`
+	LastMotion     *time.Time `json:"last_motion,omitempty"`
+	WaterLeakSince *time.Time `json:"waterleak_since,omitempty"`
 }
 
 func (d *Device) SnapshotState() (*DeviceStateSnapshot, error) {
+	var contact *bool
+	var lastContactAt *time.Time
+	if d.LastContact != nil {
+		contact = &d.LastContact.Contact
+		lastContactAt = &d.LastContact.When
+	}
+
 	return &DeviceStateSnapshot{
 		ProbablyTurnedOn:                     d.ProbablyTurnedOn,
 		LastColor:                            d.LastColor,
+		LastBrightness:                       d.LastBrightness,
+		LastColorTemperature:                 d.LastColorTemperature,
 		LastTemperatureHumidityPressureEvent: d.LastTemperatureHumidityPressureEvent,
 		LastOnline:                           d.LastOnline,
 		LinkQuality:                          d.LinkQuality,
 		BatteryPct:                           d.BatteryPct,
 		BatteryVoltage:                       d.BatteryVoltage,
+		Contact:                              contact,
+		LastContactAt:                        lastContactAt,
+		ContactSince:                         d.ContactSince,
+		LastMotion:                           d.LastMotion,
+		WaterLeakSince:                       d.WaterLeakSince,
 	}, nil
 }
 
 func (d *Device) RestoreStateFromSnapshot(snapshot DeviceStateSnapshot) error {
 	d.ProbablyTurnedOn = snapshot.ProbablyTurnedOn
 	d.LastColor = snapshot.LastColor
+	d.LastBrightness = snapshot.LastBrightness
+	d.LastColorTemperature = snapshot.LastColorTemperature
 	d.LastTemperatureHumidityPressureEvent = snapshot.LastTemperatureHumidityPressureEvent
 	d.LastOnline = snapshot.LastOnline
 	d.LinkQuality = snapshot.LinkQuality
 	d.BatteryPct = snapshot.BatteryPct
 	d.BatteryVoltage = snapshot.BatteryVoltage
+	d.ContactSince = snapshot.ContactSince
+	d.LastMotion = snapshot.LastMotion
+	d.WaterLeakSince = snapshot.WaterLeakSince
+
+	if snapshot.Contact != nil && snapshot.LastContactAt != nil {
+		d.LastContact = NewContactEvent(d.Conf.DeviceId, *snapshot.Contact, *snapshot.LastContactAt)
+	}
 
 	return nil
 }
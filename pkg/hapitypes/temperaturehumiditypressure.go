@@ -1,6 +1,7 @@
 package hapitypes
 
 type TemperatureHumidityPressureEvent struct {
+	InboundMeta
 	Device      string
 	Temperature float64
 	Humidity    float64
@@ -2,9 +2,11 @@ package hapitypes
 
 import (
 	"errors"
+	"fmt"
 	"github.com/function61/gokit/logex"
 	"github.com/function61/hautomo/pkg/constmetrics"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -27,10 +29,12 @@ import (
 type OutboundEvent interface {
 	OutboundEventType() string
 	RedirectInbound(toDeviceId string) InboundEvent
+	OutMeta() *OutboundMeta // implemented by embedding OutboundMeta
 }
 
 type InboundEvent interface {
 	InboundEventType() string
+	Meta() *InboundMeta // implemented by embedding InboundMeta
 }
 
 type RGB struct {
@@ -51,18 +55,62 @@ func (r RGB) IsGrayscale() bool {
 	return r.Red == r.Green && r.Green == r.Blue
 }
 
+// "#ff8800"
+func (r RGB) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", r.Red, r.Green, r.Blue)
+}
+
+func ParseRGB(hex string) (RGB, error) {
+	var red, green, blue uint8
+	if len(hex) != 7 {
+		return RGB{}, fmt.Errorf("invalid color: %s", hex)
+	}
+
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &red, &green, &blue); err != nil {
+		return RGB{}, fmt.Errorf("invalid color: %s", hex)
+	}
+
+	return NewRGB(red, green, blue), nil
+}
+
+var namedColors = map[string]RGB{
+	"white":     NewRGB(255, 255, 255),
+	"warmwhite": NewRGB(255, 197, 143),
+	"red":       NewRGB(255, 0, 0),
+	"green":     NewRGB(0, 255, 0),
+	"blue":      NewRGB(0, 0, 255),
+	"yellow":    NewRGB(255, 255, 0),
+	"orange":    NewRGB(255, 128, 0),
+	"purple":    NewRGB(128, 0, 255),
+	"pink":      NewRGB(255, 105, 180),
+	"cyan":      NewRGB(0, 255, 255),
+}
+
+// "#ff8800" or a named color like "orange"
+func ParseColor(color string) (RGB, error) {
+	if named, found := namedColors[color]; found {
+		return named, nil
+	}
+
+	return ParseRGB(color)
+}
+
 var ErrDeviceNotFound = errors.New("device not found")
 
 type Device struct {
 	Conf DeviceConfig
 
-	DeviceType DeviceType
+	DeviceType DeviceType // for device groups capabilities are resolved from members
+
+	GroupMembers []string // device group's direct members (devices or groups)
 
 	// probably turned on if true
 	// might be turned on even if false,
 	ProbablyTurnedOn bool
 
-	LastColor RGB
+	LastColor            RGB
+	LastBrightness       uint // 0 = unknown
+	LastColorTemperature uint // [Kelvin]. 0 = unknown, or color was set after temperature
 
 	LastTemperatureHumidityPressureEvent *TemperatureHumidityPressureEvent
 
@@ -77,6 +125,8 @@ type Device struct {
 	LastMotion             *time.Time
 	LastExplicitPowerEvent *time.Time
 	LastContact            *ContactEvent
+	ContactSince           *time.Time // when contact last changed to its current state
+	WaterLeakSince         *time.Time // nil if no water detected
 
 	LinkQuality    uint // 0-100 %
 	BatteryPct     uint // 0-100 %
@@ -118,17 +168,38 @@ type Adapter struct {
 	Logl     *logex.Leveled
 	Log      *log.Logger // if one wants to pass native logger to libraries etc.
 	confFile *ConfigFile // FIXME
+	observer EventObserver
+
+	overflowPolicy OverflowPolicy
+	sendMu         sync.Mutex
 }
 
-func NewAdapter(conf AdapterConfig, confFile *ConfigFile, inbound *InboundFabric, logger *log.Logger) *Adapter {
-	return &Adapter{
-		Conf:     conf,
-		inbound:  inbound,
-		Outbound: make(chan OutboundEvent, 32),
-		Log:      logger,
-		Logl:     logex.Levels(logger),
-		confFile: confFile,
+// observer is optional
+func NewAdapter(conf AdapterConfig, confFile *ConfigFile, inbound *InboundFabric, observer EventObserver, logger *log.Logger) (*Adapter, error) {
+	overflowPolicy, err := ParseOverflowPolicy(conf.OutboundOverflow)
+	if err != nil {
+		return nil, fmt.Errorf("adapter %s: %v", conf.Id, err)
 	}
+
+	queueSize := conf.OutboundQueueSize
+	if queueSize == 0 {
+		queueSize = defaultOutboundQueueSize
+	}
+
+	adapter := &Adapter{
+		Conf:           conf,
+		inbound:        inbound,
+		Outbound:       make(chan OutboundEvent, queueSize),
+		Log:            logger,
+		Logl:           logex.Levels(logger),
+		confFile:       confFile,
+		observer:       observer,
+		overflowPolicy: overflowPolicy,
+	}
+
+	inbound.Metrics.registerAdapter(adapter)
+
+	return adapter, nil
 }
 
 // FIXME: remove the need for this
@@ -137,14 +208,52 @@ func (a *Adapter) GetConfigFileDeprecated() *ConfigFile {
 }
 
 func (a *Adapter) Send(e OutboundEvent) {
-	// TODO: log warning if queue full?
-	a.Outbound <- e
+	if a.observer != nil {
+		a.observer.ObserveOutbound(a.Conf.Id, e)
+	}
+
+	// never blocks, so a slow adapter cannot stall the hub
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+
+	select {
+	case a.Outbound <- e:
+	default:
+		a.overflow(e)
+	}
 }
 
 func (a *Adapter) Receive(e InboundEvent) {
-	a.inbound.Receive(e)
+	a.inbound.ReceiveFrom(a.Conf.Id, e)
+}
+
+// for adapters that originate commands and want to know their outcome
+func (a *Adapter) CommandResults() *CommandResults {
+	return a.inbound.Results
+}
+
+// adapters call this after executing an outbound event (err is nil on success)
+func (a *Adapter) Report(e OutboundEvent, err error) {
+	a.inbound.Results.Report(a.result(e, err))
+}
+
+func (a *Adapter) result(e OutboundEvent, err error) CommandResult {
+	result := CommandResult{
+		CorrelationId: e.OutMeta().CorrelationId,
+		Device:        e.OutMeta().Device,
+		Adapter:       a.Conf.Id,
+		Type:          e.OutboundEventType(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
 }
 
 func (a *Adapter) LogUnsupportedEvent(e OutboundEvent) {
 	a.Logl.Error.Printf("unsupported outbound event: " + e.OutboundEventType())
+
+	a.Report(e, errors.New("unsupported outbound event: "+e.OutboundEventType()))
 }
@@ -14,3 +14,26 @@ func TestRGBIsGrayscale(t *testing.T) {
 	assert.Assert(t, NewRGB(0, 0, 255).IsGrayscale() == false)
 	assert.Assert(t, NewRGB(255, 255, 254).IsGrayscale() == false)
 }
+
+func TestParseRGB(t *testing.T) {
+	color, err := ParseRGB("#ff8800")
+	assert.Assert(t, err == nil)
+	assert.Assert(t, color == NewRGB(255, 136, 0))
+	assert.EqualString(t, color.Hex(), "#ff8800")
+
+	_, err = ParseRGB("ff8800")
+	assert.EqualString(t, err.Error(), "invalid color: ff8800")
+}
+
+func TestInboundEventRegistryKeysMatchTypes(t *testing.T) {
+	for eventType, allocate := range inboundEventTypes {
+		assert.EqualString(t, allocate().InboundEventType(), eventType)
+	}
+
+	e, err := UnmarshalInboundEvent("MotionEvent", []byte(`{"Device":"kitchenMotion","Movement":true}`))
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, e.(*MotionEvent).Device, "kitchenMotion")
+
+	_, err = UnmarshalInboundEvent("FooEvent", []byte(`{}`))
+	assert.EqualString(t, err.Error(), "unknown inbound event type: FooEvent")
+}
@@ -1,6 +1,7 @@
 package hapitypes
 
 type VibrationEvent struct {
+	InboundMeta
 	Device string
 }
 
@@ -1,12 +1,16 @@
 package hapitypes
 
 type WaterLeakEvent struct {
+	InboundMeta
 	Device        string
 	WaterDetected bool
 }
 
 func NewWaterLeakEvent(deviceId string, waterDetected bool) *WaterLeakEvent {
-	return &WaterLeakEvent{deviceId, waterDetected}
+	return &WaterLeakEvent{
+		Device:        deviceId,
+		WaterDetected: waterDetected,
+	}
 }
 
 func (e *WaterLeakEvent) InboundEventType() string {
@@ -7,16 +7,17 @@ import (
 	"github.com/function61/gokit/ezhttp"
 )
 
-func TurnOn(ctx context.Context, deviceAddr string) error {
-	return onOrOff(ctx, "http://"+deviceAddr+"/cm?cmnd=Power%20On", "ON")
+// returns power state the relay reported after the command
+func TurnOn(ctx context.Context, deviceAddr string) (bool, error) {
+	return sendPower(ctx, "http://"+deviceAddr+"/cm?cmnd=Power%20On")
 }
 
-func TurnOff(ctx context.Context, deviceAddr string) error {
-	return onOrOff(ctx, "http://"+deviceAddr+"/cm?cmnd=Power%20off", "OFF")
+func TurnOff(ctx context.Context, deviceAddr string) (bool, error) {
+	return sendPower(ctx, "http://"+deviceAddr+"/cm?cmnd=Power%20off")
 }
 
 // https://github.com/arendst/Sonoff-Tasmota/wiki/Commands#sending-commands-with-web-requests
-func onOrOff(ctx context.Context, endpoint string, expectedPowerState string) error {
+func sendPower(ctx context.Context, endpoint string) (bool, error) {
 	resp := struct {
 		Power string `json:"POWER"` // ON | OFF
 	}{}
@@ -25,12 +26,15 @@ func onOrOff(ctx context.Context, endpoint string, expectedPowerState string) er
 		ctx,
 		endpoint,
 		ezhttp.RespondsJson(&resp, true)); err != nil {
-		return err
+		return false, err
 	}
 
-	if resp.Power != expectedPowerState {
-		return fmt.Errorf("expecting POWER=%s got=%s", expectedPowerState, resp.Power)
+	switch resp.Power {
+	case "ON":
+		return true, nil
+	case "OFF":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected POWER=%s", resp.Power)
 	}
-
-	return nil
 }
@@ -41,3 +41,50 @@ func IsBetweenGoldenHours(at time.Time, position latLng) bool {
 
 	return at.After(sunTimes["goldenHourEnd"]) && at.Before(sunTimes["goldenHour"])
 }
+
+var EventNames = []string{
+	"nadir",
+	"nightEnd",
+	"nauticalDawn",
+	"dawn",
+	"sunrise",
+	"sunriseEnd",
+	"goldenHourEnd",
+	"solarNoon",
+	"goldenHour",
+	"sunsetStart",
+	"sunset",
+	"dusk",
+	"nauticalDusk",
+	"night",
+}
+
+func IsEventName(name string) bool {
+	for _, eventName := range EventNames {
+		if eventName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sun events on the day (in day's location) keyed by name. events that don't happen that day
+// (f.ex. "night" during summer near the poles) are missing from the result.
+func TimesOfDay(day time.Time, position latLng) map[string]time.Time {
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location())
+
+	calc := astrocalc.NewSunCalc()
+
+	times := map[string]time.Time{}
+	for name, at := range calc.GetTimes(noon, position.latitude, position.longitude) {
+		// sun never reaching the angle yields garbage
+		if at.Before(noon.Add(-24*time.Hour)) || at.After(noon.Add(24*time.Hour)) {
+			continue
+		}
+
+		times[name] = at.In(day.Location())
+	}
+
+	return times
+}